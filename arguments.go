@@ -7,11 +7,24 @@ import (
 
 	"bytes"
 	"strings"
+	"unicode/utf8"
 )
 
 type InvalidArgument struct {
 	msg   string
 	usage []string
+
+	input  string
+	offset int  // Where input starts, if it is only a part of the line
+	Span   Span // The offending part of the line
+}
+
+// Returns the input with a ^~~~ marker under the offending part. Empty if we dont know the input.
+func (ia *InvalidArgument) Marker() string {
+	if ia.input == "" {
+		return ""
+	}
+	return Span{ia.Span.Start - ia.offset, ia.Span.End - ia.offset}.Marker(ia.input)
 }
 
 func (ia *InvalidArgument) Error() string {
@@ -32,10 +45,9 @@ func (ia *InvalidArgument) Error() string {
 
 // Helper function to consume tokens until next command.  IE, skip whitespace after current command.
 func consumeArgumentTokens(in TokenSet) (consumed, remaining TokenSet) {
-	const SkipTokens = 1<<TokenWhitespace | 1<<TokenEOF
 	if len(in) > 0 {
 		split := 1
-		for ; split < len(in) && (1<<in[split].Type&SkipTokens) != 0; split++ {
+		for ; split < len(in) && in[split].IsWhitespace(); split++ {
 		}
 		consumed = in[:split]
 		if split+1 > len(in) {
@@ -53,6 +65,10 @@ type argNodeAssignment struct {
 	Tokens TokenSet
 
 	overflow TokenSet
+	err      error // Why the last token is not a valid value for the node
+
+	flags []argNodeAssignment // Flags given after the node
+	value string              // The value of an option
 }
 
 // Accepts Tokens, and returns a slice of slices of the tokens not used up, and a bool to indicate acceptance
@@ -65,8 +81,7 @@ func worldAcceptorFn(node *ArgNode, in TokenSet) (accepted []argNodeAssignment)
 }
 func commandAcceptorFn(node *ArgNode, in TokenSet) (accepted []argNodeAssignment) {
 	if len(in) > 0 {
-		if (len(in) == 1 && strings.Index(node.Name, in.Stringify()) == 0) ||
-			(len(in) > 1 && in.Filter(TokenNoWhitespace)[0].ToString() == node.Name) {
+		if node.isNamed(in, len(in) == 1) || node.isAbbreviated(in) {
 			con, rem := consumeArgumentTokens(in)
 			accepted = append(accepted, argNodeAssignment{Node: node, Tokens: con, overflow: rem})
 		}
@@ -75,20 +90,35 @@ func commandAcceptorFn(node *ArgNode, in TokenSet) (accepted []argNodeAssignment
 }
 func singleArgumentAcceptorFn(node *ArgNode, in TokenSet) (accepted []argNodeAssignment) {
 	con, rem := consumeArgumentTokens(in)
-	if len(con) > 0 {
+	if len(con) > 0 && con[0].Type != TokenOperator { // Only the rest argument takes operators
 		accepted = append(accepted, argNodeAssignment{Node: node, Tokens: con, overflow: rem})
 	}
 	return
 }
 
-func repeatAcceptPerm(node *ArgNode, ap acceptPermutationsFn, prefix, in TokenSet, count int) (accepted []argNodeAssignment) {
+// Takes all the tokens, operators included
+func restAcceptorFn(node *ArgNode, in TokenSet) (accepted []argNodeAssignment) {
+	if in.HasText() {
+		accepted = append(accepted, argNodeAssignment{Node: node, Tokens: in, overflow: in[len(in):]})
+	}
+	return
+}
+
+// Flags between the values are taken out, and kept with the flags of the assignment
+func repeatAcceptPerm(node *ArgNode, ap acceptPermutationsFn, prefix, in TokenSet, flags []argNodeAssignment, count int) (accepted []argNodeAssignment) {
 	if count > 0 {
+		if inner, rem := node.takeFlags(in); inner != nil {
+			flags, in = append(append([]argNodeAssignment{}, flags...), inner...), rem
+		}
 		for _, na := range ap(node, in) {
 			fullTok := append([]Token{}, prefix...)
 			fullTok = append(fullTok, na.Tokens...)
 			na.Tokens = fullTok
+			na.flags = flags
 			accepted = append(accepted, na)
-			accepted = append(accepted, repeatAcceptPerm(node, ap, fullTok, na.overflow, count-1)...)
+			if na.err == nil { // No use to continue after a bad value
+				accepted = append(accepted, repeatAcceptPerm(node, ap, fullTok, na.overflow, flags, count-1)...)
+			}
 		}
 	}
 	return
@@ -102,27 +132,62 @@ const (
 	ArgumentNode
 	OptionalNode
 	MultiArgNode
+	InputNode        // Accepts the result of the previous command in a pipeline
+	GlobNode         // Expands wildcards to matching files
+	RestNode         // Takes the rest of the line, exactly as typed
+	FlagNode         // A flag like --verbose, in the Flags of a command
+	OptionNode       // A flag that takes a value, like --user=x
+	HiddenNode       // Not in autocomplete or usage
+	DeprecatedNode   // Gives a warning when used
+	ExperimentalNode // Needs the AllowExperimental option
 )
 
 type ArgNode struct {
 	Name      string
 	Descr     string
 	Children  []*ArgNode
+	Aliases   []string    // Other names of a command
+	Flags     []*ArgNode  // Flags and options of a command
+	Groups    []*ArgGroup // Flags of a command that depend on each other
+	Short     rune        // The short name of a flag, like v for -v
 	TypeFlags NodeTypeFlags
+	ArgType   *ArgType // For typed arguments, else nil
+
+	DefaultDescr string // Shown in usage, like [port?=6667]
+	defaultFn    DefaultFn
+	EnvVar       string // Where the value is taken from when omitted, ahead of the default
+	Deprecation  string // What to use instead, for a deprecated node
 	AcSugestorFn
 	AcInvokerFn
 
 	acceptPermutationsFn
 
 	RunHandler
+
+	parent   *ArgNode
+	options  *ParserOptions // Only set on the world node
+	maxTimes uint64         // The most values of a multi argument
 }
 
 func NewWorldNode() *ArgNode {
-	return &ArgNode{Name: "", AcSugestorFn: worldSugestorFn, acceptPermutationsFn: worldAcceptorFn, TypeFlags: WorldNode}
+	return &ArgNode{Name: "", AcSugestorFn: worldSugestorFn, acceptPermutationsFn: worldAcceptorFn, TypeFlags: WorldNode, options: new(ParserOptions)}
+}
+
+// Gets the options from the world node, or 0 if the node is not in a world
+func (an *ArgNode) parserOptions() ParserOptions {
+	for n := an; n != nil; n = n.parent {
+		if n.options != nil {
+			return *n.options
+		}
+	}
+	return 0
 }
 
 func (an *ArgNode) AddCustomNode(name string, acsFn AcSugestorFn, aciFn AcInvokerFn, apFn acceptPermutationsFn, typeFlags NodeTypeFlags) *ArgNode {
-	n := &ArgNode{Name: name, AcSugestorFn: acsFn, AcInvokerFn: aciFn, acceptPermutationsFn: apFn, TypeFlags: typeFlags}
+	if an.TypeFlags&RestNode != 0 {
+		log.Panicf("Can not add %s after %s, since it takes the rest of the line", name, an.Name)
+	}
+	n := &ArgNode{Name: name, AcSugestorFn: acsFn, AcInvokerFn: aciFn, acceptPermutationsFn: apFn, TypeFlags: typeFlags, parent: an}
 	for _, c := range an.Children {
 		if !c.allowSibling(n) {
 			log.Panicf("Sibling not allowed: %+v and %+v wont get along", n, c)
@@ -136,10 +201,107 @@ func (an *ArgNode) AddSubCommand(name string) *ArgNode {
 	return an.AddCustomNode(name, commandSugestorFn, cmdInvokerFn, commandAcceptorFn, CommandNode)
 }
 
+// Adds other names for a command, like /j for /join
+func (an *ArgNode) Alias(aliases ...string) *ArgNode {
+	if an.TypeFlags&CommandNode == 0 {
+		log.Panicf("Can not add alias to %s, since it is not a command", an.Name)
+	}
+	alias := &ArgNode{Name: an.Name, Aliases: aliases}
+	for _, c := range an.parent.Children {
+		if c != an && !c.allowSibling(alias) {
+			log.Panicf("Alias not allowed: %v for %s clashes with %s", aliases, an.Name, c.Name)
+		}
+	}
+	an.Aliases = append(an.Aliases, aliases...)
+	return an
+}
+
+// Checks if the first word is the name or an alias of the node. When completing, a prefix is enough.
+func (an *ArgNode) isNamed(in TokenSet, prefix bool) bool {
+	word := in.Filter(TokenNoWhitespace)
+	if len(word) == 0 {
+		return false
+	}
+	typed := word[0].ToString()
+	ignoreCase := an.parserOptions()&IgnoreCase != 0
+	for _, name := range append([]string{an.Name}, an.Aliases...) {
+		switch {
+		case prefix && ignoreCase && hasPrefixFold(name, typed),
+			prefix && strings.HasPrefix(name, typed),
+			ignoreCase && strings.EqualFold(typed, name),
+			typed == name:
+			return true
+		}
+	}
+	return false
+}
+
+// Like strings.HasPrefix, but ignores case like strings.EqualFold
+func hasPrefixFold(s, prefix string) bool {
+	for _, r := range prefix {
+		c, w := utf8.DecodeRuneInString(s)
+		if w == 0 || !strings.EqualFold(string(c), string(r)) {
+			return false
+		}
+		s = s[w:]
+	}
+	return true
+}
+
+// Checks if the first word is an unambiguous prefix of the name of the command, when abbreviations are allowed
+func (an *ArgNode) isAbbreviated(in TokenSet) bool {
+	if an.parent == nil {
+		return false
+	}
+	cmds := an.parent.abbreviationsOf(in)
+	return len(cmds) == 1 && cmds[0] == an.Name
+}
+
+// Lists the commands under the node that the first word is a prefix of, when abbreviations are allowed.
+// Empty if the word is the full name of one of them, since that is not an abbreviation.
+func (an *ArgNode) abbreviationsOf(in TokenSet) (cmds []string) {
+	if an.parserOptions()&AbbreviateCommands == 0 {
+		return nil
+	}
+	for _, c := range an.Children {
+		if c.TypeFlags&CommandNode == 0 || c.isHidden() {
+			continue
+		} else if c.isNamed(in, false) {
+			return nil
+		} else if c.isNamed(in, true) {
+			cmds = append(cmds, c.Name)
+		}
+	}
+	return
+}
+
+// Follows the commands in the input, and describes the first abbreviation that could be several commands.
+// Empty if there is none.
+func (an *ArgNode) ambiguous(in TokenSet) string {
+	in = in.Trimmed()
+	if cmds := an.abbreviationsOf(in); len(cmds) > 1 {
+		return "Ambiguous command: " + in[0].ToString() + ", could be: " + strings.Join(cmds, ", ")
+	}
+	con, rem := consumeArgumentTokens(in)
+	for _, c := range an.Children {
+		if c.TypeFlags&CommandNode != 0 && rem.HasText() && (c.isNamed(con, false) || c.isAbbreviated(con)) {
+			return c.ambiguous(rem)
+		}
+	}
+	return ""
+}
+
 func (an *ArgNode) AddArgument(name string) *ArgNode {
 	return an.AddCustomNode(name, getArgumentSugestorFn(name), getArgumentInvokerFn(name), singleArgumentAcceptorFn, ArgumentNode)
 }
 
+// Adds an argument that takes the rest of the line, exactly as typed. Whitespaces, quotes and escapes are kept,
+// and so are operators like ; and |, so the line is not split into several commands after it.
+// Nothing can be added after it.
+func (an *ArgNode) AddRest(name string) *ArgNode {
+	return an.AddCustomNode(name, getRestSugestorFn(name), getRestInvokerFn(name), restAcceptorFn, ArgumentNode|RestNode)
+}
+
 func (an *ArgNode) Handler(rhf RunHandlerFunc) *ArgNode {
 	an.RunHandler = rhf
 	return an
@@ -147,7 +309,7 @@ func (an *ArgNode) Handler(rhf RunHandlerFunc) *ArgNode {
 
 func (an *ArgNode) Weight(ts TokenSet) int {
 	if an.TypeFlags&CommandNode > 0 {
-		if ts.Trimmed().String() != an.Name {
+		if !an.isNamed(ts, false) && !an.isAbbreviated(ts) {
 			return -100 // We didn't match 100%
 		} else {
 			return 2
@@ -156,6 +318,12 @@ func (an *ArgNode) Weight(ts TokenSet) int {
 	return 1
 }
 
+// Lets the command accept piped input, from RunContext.Input
+func (an *ArgNode) AcceptsInput() *ArgNode {
+	an.TypeFlags |= InputNode
+	return an
+}
+
 func (an *ArgNode) Optional() *ArgNode {
 	return an.Times(0, 1)
 }
@@ -173,6 +341,7 @@ func (an *ArgNode) Times(min, max uint64) *ArgNode {
 	if max > 1 {
 		an.TypeFlags |= MultiArgNode
 	}
+	an.maxTimes = max
 
 	oldApFn := an.acceptPermutationsFn
 	an.acceptPermutationsFn = func(node *ArgNode, in TokenSet) (accepted []argNodeAssignment) {
@@ -183,8 +352,11 @@ func (an *ArgNode) Times(min, max uint64) *ArgNode {
 		}
 		if max > 1 {
 			for _, na := range oneMatchAssign {
+				if na.err != nil {
+					continue
+				}
 				// TODO: We could get duplications in the result here.  We should filter...
-				accepted = append(accepted, repeatAcceptPerm(node, oldApFn, na.Tokens, na.overflow, int(max-1))...)
+				accepted = append(accepted, repeatAcceptPerm(node, oldApFn, na.Tokens, na.overflow, nil, int(max-1))...)
 			}
 		}
 		return
@@ -194,14 +366,22 @@ func (an *ArgNode) Times(min, max uint64) *ArgNode {
 
 func (an *ArgNode) allowSibling(new *ArgNode) bool {
 	// If we really want to be strict, we should check the whole tree
-	return an.Name != new.Name // For now, just dont like to share name
+	// For now, just dont like to share name or alias
+	for _, name := range append([]string{an.Name}, an.Aliases...) {
+		for _, newName := range append([]string{new.Name}, new.Aliases...) {
+			if name == newName {
+				return false
+			}
+		}
+	}
+	return true
 }
 
 // This method should return true if we can be optional.
-// That is, if we are optional _and_ do not have children,
+// That is, if we are optional (or taken from the environment) _and_ do not have children,
 // or if atleast one of those children is an optional branch.
 func (an *ArgNode) isOptionalBranch() bool {
-	if (an.TypeFlags & OptionalNode) == OptionalNode {
+	if an.omittable() {
 		if len(an.Children) == 0 {
 			return true
 		}
@@ -215,6 +395,9 @@ func (an *ArgNode) isOptionalBranch() bool {
 }
 
 func (an *ArgNode) SugestAutoComplete(in TokenSet) []string {
+	if an.isHidden() {
+		return nil
+	}
 	return an.Sugest(an, in)
 }
 
@@ -241,17 +424,77 @@ func (an *ArgNode) generateCommandAssingPaths(in TokenSet) (finalPaths []command
 	return
 }
 
+// Hidden commands, and what comes after them, are left out. A hidden argument is left out,
+// but what comes after it is shown, like it followed the node before it.
+// Arguments in a group are shown together, where the first of them is.
 func (an *ArgNode) Usage(prfix, descpr string) (ret []string) {
+	g, cmd := an.argumentGroup()
+	if (an.isHidden() && an.TypeFlags&ArgumentNode != 0) || (g != nil && g.first(cmd) != an) {
+		for _, c := range an.Children {
+			ret = append(ret, c.Usage(prfix, descpr)...)
+		}
+		if an.Descr != "" && !an.isHidden() {
+			ret = append(ret, descpr+an.Name+": "+an.Descr)
+		}
+		return
+	} else if an.isHidden() {
+		return
+	}
 	var buf bytes.Buffer
 
 	isArg := an.TypeFlags&ArgumentNode != 0
 
 	buf.WriteString(prfix)
+	if g != nil {
+		buf.WriteString(g.usage(cmd))
+	} else {
+		an.writeUsage(&buf)
+	}
+	an.flagUsage(&buf)
+
+	pr := buf.String() + " "
+	for _, c := range an.Children {
+		ret = append(ret, c.Usage(pr, descpr)...)
+	}
+	if len(ret) == 0 { // No children, or only hidden ones
+		ret = append(ret, buf.String())
+	}
+	if an.Descr != "" {
+		if isArg {
+			ret = append(ret, descpr+an.Name+": "+an.Descr)
+		} else {
+			ret = append(ret, descpr+"* "+an.Descr)
+		}
+	}
+	for _, f := range an.Flags {
+		if f.Descr != "" && !f.isHidden() {
+			ret = append(ret, descpr+"--"+f.Name+": "+f.Descr)
+		}
+	}
+	return
+}
+
+// Writes the node, like /join|/j or [port:int?=6667]
+func (an *ArgNode) writeUsage(buf *bytes.Buffer) {
+	isArg := an.TypeFlags&ArgumentNode != 0
 	if isArg {
 		buf.WriteRune('[')
 	}
 
 	buf.WriteString(an.Name)
+	for _, alias := range an.Aliases {
+		buf.WriteRune('|')
+		buf.WriteString(alias)
+	}
+
+	if an.ArgType != nil {
+		buf.WriteRune(':')
+		buf.WriteString(an.ArgType.Name)
+	}
+
+	if an.TypeFlags&RestNode != 0 {
+		buf.WriteString("...")
+	}
 
 	if an.TypeFlags&MultiArgNode != 0 {
 		buf.WriteRune('*')
@@ -261,27 +504,14 @@ func (an *ArgNode) Usage(prfix, descpr string) (ret []string) {
 		buf.WriteRune('?')
 	}
 
-	if isArg {
-		buf.WriteRune(']')
+	if def := an.defaultUsage(); def != "" {
+		buf.WriteRune('=')
+		buf.WriteString(def)
 	}
 
-	if len(an.Children) == 0 {
-		ret = append(ret, buf.String())
-	} else {
-		buf.WriteRune(' ')
-		pr := buf.String()
-		for _, c := range an.Children {
-			ret = append(ret, c.Usage(pr, descpr)...)
-		}
-	}
-	if an.Descr != "" {
-		if isArg {
-			ret = append(ret, descpr+an.Name+": "+an.Descr)
-		} else {
-			ret = append(ret, descpr+"* "+an.Descr)
-		}
+	if isArg {
+		buf.WriteRune(']')
 	}
-	return
 }
 
 func (an *ArgNode) Description(str string) *ArgNode {
@@ -289,35 +519,145 @@ func (an *ArgNode) Description(str string) *ArgNode {
 	return an
 }
 
+// Invokes a single command. Chains, pipes, redirects and here-documents need CommandParser.Execute,
+// so an operator that no argument takes gives an error saying so.
 func (an *ArgNode) InvokeCommand(input string, rc RunContext) (res interface{}, err error) {
-	tokens := Tokenize(input)
-	if tokens.HasText() {
-		paths := an.generateCommandAssingPaths(tokens)
-		// log.Print("Invoked PATHS: ", paths)
+	return an.InvokeTokens(Tokenize(input), rc)
+}
 
-		min := 0
+// Like InvokeCommand, but with input that is already tokenized
+func (an *ArgNode) InvokeTokens(tokens TokenSet, rc RunContext) (res interface{}, err error) {
+	if err = tokens.Err(); err != nil {
+		return
+	}
+	if tokens.HasText() {
 		var path commandAssignPath
+		if path, err = an.assignTokens(tokens); err == nil {
+			res, err = path.Invoke(rc)
+		} else if op := firstOperator(tokens); op != nil {
+			// Likely a chain or redirect, which only the parser can run
+			err = &InvalidArgument{msg: "Operators like " + op.val + " need CommandParser.Execute. Quote or escape it to use it as text",
+				input: tokens.String(), offset: tokens[0].Pos, Span: op.Span()}
+		}
+	}
+	return
+}
 
-		for _, p := range paths {
-			// 			log.Print(p[0].Node.Name, " = ", p.Score(), ": ", p.String())
-			if p.Score() > min {
-				min = p.Score()
-				path = p
+func firstOperator(ts TokenSet) *Token {
+	for idx := range ts {
+		if ts[idx].Type == TokenOperator {
+			return &ts[idx]
+		}
+	}
+	return nil
+}
+
+// Finds the best path for the tokens, or returns an InvalidArgument describing why nothing matched
+func (an *ArgNode) assignTokens(tokens TokenSet) (path commandAssignPath, err error) {
+	paths := an.generateCommandAssingPaths(tokens)
+	// log.Print("Invoked PATHS: ", paths)
+
+	if path = bestPath(paths); path != nil {
+		if err = path.checkExperimental(); err == nil {
+			err = path.checkGroups()
+		}
+		if err == nil {
+			// Globs are expanded after assignment, so each match does not need a token of its own
+			err = path.expandGlobs()
+		}
+		if ia, ok := err.(*InvalidArgument); ok {
+			ia.input, ia.offset = tokens.String(), tokens[0].Pos
+		}
+	} else {
+		input := tokens.String()
+		usage := []string{}
+		cmd := strings.Split(input, " ")[0]
+		for _, use := range an.Usage("\t\t", "\t\t\t: ") {
+			if strings.Index(use, cmd) >= 0 {
+				usage = append(usage, use)
 			}
 		}
 
-		if path != nil {
-			res, err = path.Invoke(rc)
-		} else {
-			usage := []string{}
-			cmd := strings.Split(input, " ")[0]
-			for _, use := range an.Usage("\t\t", "\t\t\t: ") {
-				if strings.Index(use, cmd) >= 0 {
-					usage = append(usage, use)
+		msg, span := an.describeFailedPaths(tokens, paths)
+		err = &InvalidArgument{msg: msg, usage: usage, input: input, offset: tokens[0].Pos, Span: span}
+	}
+	return
+}
+
+// Returns the path with the highest positive score, or nil
+func bestPath(paths []commandAssignPath) (path commandAssignPath) {
+	min := 0
+	for _, p := range paths {
+		// 			log.Print(p[0].Node.Name, " = ", p.Score(), ": ", p.String())
+		if p.Score() > min {
+			min = p.Score()
+			path = p
+		}
+	}
+	return
+}
+
+// Checks if the best path for the tokens ends with a rest argument
+func (an *ArgNode) takesRest(tokens TokenSet) bool {
+	return an.restStart(tokens) >= 0
+}
+
+// Returns the position of the rest argument that the best path for the tokens ends with, or -1 if it does not
+func (an *ArgNode) restStart(tokens TokenSet) int {
+	path := bestPath(an.generateCommandAssingPaths(tokens))
+	if path == nil || path.leaf().Node.TypeFlags&RestNode == 0 {
+		return -1
+	}
+	return path.leaf().Tokens[0].Pos
+}
+
+// Finds out why no path was good enough, by looking at the path that got the furthest.
+// Paths where a command only matched on prefix are not considered, unless the prefix was ambiguous.
+func (an *ArgNode) describeFailedPaths(tokens TokenSet, paths []commandAssignPath) (msg string, span Span) {
+	span = tokens.Trimmed()[0].Span()
+	msg = "Unknown command: " + tokens.String()
+	if amb := an.ambiguous(tokens); amb != "" {
+		msg = amb
+	}
+	reach := -1
+	for _, p := range paths {
+		var inexact *argNodeAssignment
+		for idx := range p {
+			if inexact == nil && p[idx].Node.Weight(p[idx].Tokens) <= 0 {
+				inexact = &p[idx]
+			}
+		}
+		if inexact != nil {
+			if amb := inexact.Node.parent.ambiguous(inexact.Tokens); amb != "" && inexact.Tokens[0].Pos > reach {
+				reach = inexact.Tokens[0].Pos
+				span = inexact.Tokens.Trimmed()[0].Span()
+				msg = amb
+			}
+			continue
+		}
+		if bad := p.badValue(); bad != nil && bad.Tokens.HasText() {
+			// A bad value is a better explanation than an unexpected argument at the same place
+			if t := bad.Tokens.Trimmed(); t[len(t)-1].Pos >= reach {
+				reach = t[len(t)-1].Pos
+				span = t[len(t)-1].Span()
+				msg = bad.err.Error()
+			}
+		} else if rest := p.leaf().overflow.Trimmed(); len(rest) > 0 {
+			if rest[0].Pos > reach {
+				reach = rest[0].Pos
+				span = rest[0].Span()
+				msg = "Unexpected argument: " + rest[0].Value()
+				if amb := p.leaf().Node.ambiguous(rest); amb != "" {
+					msg = amb
 				}
 			}
-
-			err = &InvalidArgument{"Unknown command: " + input, usage}
+		} else if end := tokens.Span().End; end > reach {
+			reach = end
+			span = Span{end, end}
+			msg = "Missing argument for: " + tokens.Stringify()
+			if hints := p.missingFromEnv(); len(hints) > 0 {
+				msg += ". " + strings.Join(hints, ". ")
+			}
 		}
 	}
 	return
@@ -338,7 +678,7 @@ func (cap *commandAssignPath) SugestAutoComplete() (ret []string) {
 	if sugestions := leaf.Node.SugestAutoComplete(leaf.Tokens); len(sugestions) > 0 {
 		var prefix bytes.Buffer
 		for i := 0; i < len(*cap)-1; i++ {
-			prefix.WriteString((*cap)[i].Tokens.String())
+			prefix.WriteString((*cap)[i].text())
 		}
 
 		for _, sug := range sugestions {
@@ -348,7 +688,7 @@ func (cap *commandAssignPath) SugestAutoComplete() (ret []string) {
 			ret = append(ret, full.String())
 		}
 	}
-	return
+	return append(ret, cap.sugestFlags()...)
 }
 
 // Nice printing for easier debugging
@@ -397,6 +737,7 @@ func chainProcAssignments(pa ...procAssignmentFn) procAssignmentFn {
 
 func (cap *commandAssignPath) parseNext(result procAssignmentResult) procAssignmentFn {
 	leaf := cap.leaf()
+	cap.takeFlags(leaf)
 	if len(leaf.overflow) > 0 {
 		perm := leaf.Node.assignChildNodes(leaf.overflow)
 		if len(perm) > 0 {
@@ -417,7 +758,7 @@ func (cap *commandAssignPath) parseNext(result procAssignmentResult) procAssignm
 
 		// Might still have child nodes, and if we ended with whitespace, they are candidates for autocomplete.
 		// Only include them if we already have text. If not, we are the leaf for autocomplete
-		if leaf.Tokens.HasText() && leaf.Tokens[len(leaf.Tokens)-1].Type == TokenEOF {
+		if leaf.Tokens.HasText() && leaf.lastToken().Type == TokenEOF {
 			for _, c := range leaf.Node.Children {
 				newCap := append(commandAssignPath{}, (*cap)...)
 				newCap = append(newCap, argNodeAssignment{Node: c})
@@ -428,10 +769,34 @@ func (cap *commandAssignPath) parseNext(result procAssignmentResult) procAssignm
 	return nil
 }
 
+// Returns the first assignment with a value that did not convert, or nil
+func (cap *commandAssignPath) badValue() *argNodeAssignment {
+	for idx := range *cap {
+		if (*cap)[idx].err != nil {
+			return &(*cap)[idx]
+		}
+		for fi := range (*cap)[idx].flags {
+			if (*cap)[idx].flags[fi].err != nil {
+				return &(*cap)[idx].flags[fi]
+			}
+		}
+	}
+	return nil
+}
+
 func (cap *commandAssignPath) Score() int {
 	score := 0
 	for _, ass := range *cap {
 		score += ass.Node.Weight(ass.Tokens)
+		if ass.err != nil {
+			score -= 100 // A bad value
+		}
+		for _, f := range ass.flags {
+			score++
+			if f.err != nil {
+				score -= 100
+			}
+		}
 	}
 	leaf := cap.leaf()
 
@@ -453,12 +818,28 @@ func (cap *commandAssignPath) Score() int {
 	return score
 }
 
+// Checks if any node on the path accepts piped input
+func (cap *commandAssignPath) acceptsInput() bool {
+	for _, ass := range *cap {
+		if ass.Node.TypeFlags&InputNode != 0 {
+			return true
+		}
+	}
+	return false
+}
+
 func (cap *commandAssignPath) Invoke(context RunContext) (interface{}, error) {
 	for _, ass := range *cap {
 		if ass.Node.RunHandler != nil {
 			context.Handler(ass.Node.RunHandler)
 		}
 		ass.Node.Invoke(&ass, context)
+		for _, f := range ass.flags {
+			f.Node.Invoke(&f, context)
+		}
+	}
+	if err := cap.applyDefaults(context); err != nil {
+		return nil, err
 	}
 	return context.Invoke()
 }
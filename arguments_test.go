@@ -1,6 +1,8 @@
 package gocop
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -131,8 +133,8 @@ func TestCommandAssignPath_Invoke(t *testing.T) {
 	n := NewWorldNode()
 	n.AddSubCommand("cmd").AddArgument("arg1").AddArgument("arg2").Optional().AddArgument("arg3").Handler(func(rc RunContext) (interface{}, error) {
 		assertEqual(t, "argument1", rc.Get("arg1"))
-		assertEqual(t, "arg2\\ nr\\ 2", rc.Get("arg2"))
-		assertEqual(t, "'Argument Nummer 3'", rc.Get("arg3"))
+		assertEqual(t, "arg2 nr 2", rc.Get("arg2"))
+		assertEqual(t, "Argument Nummer 3", rc.Get("arg3"))
 		return "Good", nil
 	})
 	t.Log("World node: ", n)
@@ -176,3 +178,205 @@ func TestCommandAssignPath_GreedyPath(t *testing.T) {
 		t.Log("Expected 4 results")
 	}
 }
+
+func TestInvokeCommand_ErrorSpan(t *testing.T) {
+	n := NewWorldNode()
+	n.AddSubCommand("/nick").AddArgument("nick")
+	n.AddSubCommand("/connect").AddArgument("server").AddArgument("nick").Optional()
+
+	check := func(input, expMarker string) {
+		_, err := n.InvokeCommand(input, &DefaultRunContext{values: make(map[string]string)})
+		ia, ok := err.(*InvalidArgument)
+		if !ok {
+			t.Errorf("Expected InvalidArgument for '%s', but got %+v", input, err)
+			return
+		}
+		t.Log(ia.msg)
+		assertEqual(t, expMarker, ia.Marker())
+	}
+
+	check("/nick one two", "/nick one two\n          ^~~\n")
+	check("/connect srv nick extra", "/connect srv nick extra\n                  ^~~~~\n")
+	check("/connect ", "/connect \n        ^\n")
+	check("/unknown arg", "/unknown arg\n^~~~~~~~\n")
+}
+
+func TestInvokeCommand_LexicalError(t *testing.T) {
+	n := NewWorldNode()
+	run := 0
+	n.AddSubCommand("/msg").AddArgument("message").Times(1, 99).Handler(func(rc RunContext) (interface{}, error) {
+		run++
+		return nil, nil
+	})
+
+	check := func(input, expReason, expMarker string) {
+		_, err := n.InvokeCommand(input, &DefaultRunContext{values: make(map[string]string)})
+		le, ok := err.(*LexicalError)
+		if !ok {
+			t.Errorf("Expected LexicalError for %q, but got %+v", input, err)
+			return
+		}
+		t.Log(le)
+		assertEqual(t, expReason, le.Reason)
+		assertEqual(t, expMarker, le.Marker())
+	}
+
+	check("/msg bad \xff byte", "Invalid UTF-8 byte 0xff", "/msg bad \xff byte\n         ^\n")
+	check("/msg nul\x00", "Control character U+0000", "/msg nul\x00\n        ^\n")
+	check("/msg 'bell \a'", "Control character U+0007", "/msg 'bell \a'\n           ^\n")
+	check("/msg end\\", "Escape at end of input", "/msg end\\\n        ^\n")
+	assertEqual(t, "0", fmt.Sprint(run))
+
+	_, err := n.InvokeCommand("/msg tab\tand\\\\", &DefaultRunContext{values: make(map[string]string)})
+	assertEqual(t, "<nil>", fmt.Sprint(err))
+	assertEqual(t, "1", fmt.Sprint(run))
+}
+
+func TestInvokeCommand_Operators(t *testing.T) {
+	n := NewWorldNode()
+	n.AddSubCommand("/msg").AddArgument("user").AddArgument("message").Times(1, 99).Handler(func(rc RunContext) (interface{}, error) {
+		return rc.Get("user") + ":" + rc.Get("message"), nil
+	})
+	n.AddSubCommand("/say").AddArgument("user").AddRest("message").Handler(func(rc RunContext) (interface{}, error) {
+		return rc.Get("user") + ":" + rc.Get("message"), nil
+	})
+
+	check := func(input, expected, expMarker string) {
+		res, err := n.InvokeCommand(input, &DefaultRunContext{values: make(map[string]string)})
+		if ia, ok := err.(*InvalidArgument); ok {
+			res = strings.Split(err.Error(), "\n")[0]
+			assertEqual(t, expMarker, ia.Marker())
+		}
+		t.Logf("%q -> %v", input, res)
+		assertEqual(t, expected, fmt.Sprint(res))
+	}
+
+	check("/msg bob a;b", "Operators like ; need CommandParser.Execute. Quote or escape it to use it as text", "/msg bob a;b\n          ^\n")
+	check("/msg bob a && b", "Operators like && need CommandParser.Execute. Quote or escape it to use it as text", "/msg bob a && b\n           ^~\n")
+	check("/msg bob 'a;b'", "bob:a;b", "")
+	check("/say bob a;b", "bob:a;b", "") // The rest argument takes operators
+}
+
+func TestArgNode_AddRest(t *testing.T) {
+	n := NewWorldNode()
+	n.AddSubCommand("/msg").AddArgument("user").AddRest("message").Handler(func(rc RunContext) (interface{}, error) {
+		return rc.Get("user") + ":" + rc.Get("message"), nil
+	})
+
+	check := func(input, expected string) {
+		res, err := n.InvokeCommand(input, &DefaultRunContext{values: make(map[string]string)})
+		if err != nil {
+			res = err.Error()
+		}
+		t.Logf("%q -> %q", input, res)
+		assertEqual(t, expected, fmt.Sprint(res))
+	}
+
+	check("/msg bob hello", "bob:hello")
+	check("/msg 'bob' hello   \"big\"  'world' \\o/  ", `bob:hello   "big"  'world' \o/`)
+	check("/msg bob a; b | c > d && $e", "bob:a; b | c > d && $e")
+	check("/msg bob", "Missing argument for: /msg bob\nClose matches:\n\t\t /msg [user] [message...]\nFor full help, type: help\n")
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("Expected panic when adding after the rest argument")
+		}
+	}()
+	n.AddSubCommand("/raw").AddRest("data").AddArgument("more")
+}
+
+func TestArgNode_Alias(t *testing.T) {
+	n := NewWorldNode()
+	n.AddSubCommand("/join").Alias("/j").Handler(func(rc RunContext) (interface{}, error) {
+		return "join " + rc.Get("/join") + " " + rc.Get("channel"), nil
+	}).AddArgument("channel")
+	n.AddSubCommand("help").Handler(func(rc RunContext) (interface{}, error) {
+		return "help", nil
+	})
+	n.AddSubCommand("kick").Handler(func(rc RunContext) (interface{}, error) {
+		return "kick", nil
+	})
+
+	check := func(input, expected string) {
+		res, err := n.InvokeCommand(input, &DefaultRunContext{values: make(map[string]string)})
+		if err != nil {
+			res = strings.Split(err.Error(), "\n")[0]
+		}
+		t.Logf("%q -> %v", input, res)
+		assertEqual(t, expected, fmt.Sprint(res))
+	}
+
+	check("/join #a", "join /join #a")
+	check("/j #a", "join /join #a")
+	check("/J #a", "Unknown command: /J #a")
+	check("HELP", "Unknown command: HELP")
+	assertEqual(t, "/join", strings.Join(n.SugestAutoComplete(Tokenize("/j")), ","))
+
+	*n.options = IgnoreCase
+	check("/J #a", "join /join #a")
+	check("/JOIN #a", "join /join #a")
+	check("HELP", "help")
+	check("HELPS", "Unknown command: HELPS")
+	check(`"HELP"`, "help")
+	check("\u212Aick", "kick") // The Kelvin sign folds to k, but is longer in UTF-8
+	assertEqual(t, "help", strings.Join(n.SugestAutoComplete(Tokenize("He")), ","))
+	assertEqual(t, "help", strings.Join(n.SugestAutoComplete(Tokenize(`"HE`)), ","))
+	assertEqual(t, "kick", strings.Join(n.SugestAutoComplete(Tokenize("\u212Ai")), ","))
+
+	assertEqual(t, " /join|/j [channel]", n.Usage("", "")[0])
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("Expected panic for an alias that clashes with a sibling")
+		}
+	}()
+	n.AddSubCommand("/part").Alias("/p", "/j")
+}
+
+func TestArgNode_AliasClashWithName(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("Expected panic for a name that clashes with an alias")
+		}
+	}()
+	n := NewWorldNode()
+	n.AddSubCommand("/join").Alias("/j")
+	n.AddSubCommand("/j")
+}
+
+func TestArgNode_AbbreviateCommands(t *testing.T) {
+	n := NewWorldNode()
+	handler := func(rc RunContext) (interface{}, error) {
+		return rc.Get("show") + " " + rc.Get("interfaces") + rc.Get("inventory") + rc.Get("version") + " " + rc.Get("name"), nil
+	}
+	show := n.AddSubCommand("show")
+	show.AddSubCommand("interfaces").Handler(handler).AddArgument("name").Optional()
+	show.AddSubCommand("inventory").Handler(handler)
+	show.AddSubCommand("version").Handler(handler)
+	n.AddSubCommand("shutdown").Handler(handler)
+	n.AddSubCommand("set").Handler(func(rc RunContext) (interface{}, error) { return "set", nil })
+	n.AddSubCommand("setup").Handler(func(rc RunContext) (interface{}, error) { return "setup", nil })
+
+	check := func(input, expected string) {
+		res, err := n.InvokeCommand(input, &DefaultRunContext{values: make(map[string]string)})
+		if err != nil {
+			res = strings.Split(err.Error(), "\n")[0]
+		}
+		t.Logf("%q -> %v", input, res)
+		assertEqual(t, expected, fmt.Sprint(res))
+	}
+
+	check("sho int", "Unknown command: sho int")
+
+	*n.options = AbbreviateCommands
+	check("sho int", "show interfaces ")
+	check("sho int eth0", "show interfaces eth0")
+	check("sho v", "show version ")
+	check("set", "set")
+	check("setu", "setup")
+	check("sh int", "Ambiguous command: sh, could be: show, shutdown")
+	check("s", "Ambiguous command: s, could be: show, shutdown, set, setup")
+	check("show in", "Ambiguous command: in, could be: interfaces, inventory")
+	check("show in eth0", "Ambiguous command: in, could be: interfaces, inventory")
+	check("show x", "Unknown command: show x")
+}
@@ -34,17 +34,22 @@ type AcSugestor interface {
 
 func worldSugestorFn(node *ArgNode, in TokenSet) (res []string) {
 	paths := node.generateCommandAssingPaths(in)
+	seen := make(map[string]bool) // Optional arguments give several paths with the same flags
 	for _, p := range paths {
-		sac := p.SugestAutoComplete()
-		res = append(res, sac...)
+		for _, sac := range p.SugestAutoComplete() {
+			if !seen[sac] {
+				seen[sac] = true
+				res = append(res, sac)
+			}
+		}
 	}
 	return
 }
 
 // AcSugestorFn for commands
 func commandSugestorFn(node *ArgNode, in TokenSet) (ret []string) {
-	if len(in) == 1 && strings.Index(node.Name, in[0].val) == 0 {
-		return []string{node.Name}
+	if len(in) == 1 && node.isNamed(in, true) {
+		return []string{node.Name} // Also for an alias, since the name tells what it is
 	}
 	return
 }
@@ -54,15 +59,26 @@ func getArgumentSugestorFn(name string) AcSugestorFn {
 	sugestionSlice := getArgumentAutoSlice(name)
 	return func(node *ArgNode, in TokenSet) (ret []string) {
 		if len(in) <= 1 {
-			val := in.String()
-			if len(val) > 0 {
-				for _, ss := range *sugestionSlice {
-					if strings.Index(ss, val) == 0 {
-						ret = append(ret, ss)
-					}
+			// The slice has decoded values, so we compare with what is typed so far, and quote the sugestion
+			val := in.Value()
+			for _, ss := range *sugestionSlice {
+				if strings.Index(ss, val) == 0 {
+					ret = append(ret, in.config().Quote(ss))
 				}
-			} else {
-				ret = append(ret, *sugestionSlice...)
+			}
+		}
+		return
+	}
+}
+
+// The rest is taken as typed, so we sugest it as it is
+func getRestSugestorFn(name string) AcSugestorFn {
+	sugestionSlice := getArgumentAutoSlice(name)
+	return func(node *ArgNode, in TokenSet) (ret []string) {
+		val := in.String()
+		for _, ss := range *sugestionSlice {
+			if strings.Index(ss, val) == 0 {
+				ret = append(ret, ss)
 			}
 		}
 		return
@@ -90,11 +106,20 @@ func cmdInvokerFn(assignment *argNodeAssignment, context RunContext) {
 	context.Put(name, name) // We save our name, so we know this command was invoked
 }
 
+func getRestInvokerFn(name string) AcInvokerFn {
+	sugestionSlice := getArgumentAutoSlice(name)
+	return func(assignment *argNodeAssignment, context RunContext) {
+		raw := assignment.Tokens.rest()
+		*sugestionSlice = append(*sugestionSlice, raw)
+		context.Put(name, raw)
+	}
+}
+
 func getArgumentInvokerFn(name string) AcInvokerFn {
 	sugestionSlice := getArgumentAutoSlice(name)
 	return func(assignment *argNodeAssignment, context RunContext) {
-		val := assignment.Tokens.Stringify()
-		*sugestionSlice = append(*sugestionSlice, val)
-		context.Put(name, val)
+		value := assignment.Tokens.Value()
+		*sugestionSlice = append(*sugestionSlice, value) // Quoted when sugested
+		context.Put(name, value)
 	}
 }
@@ -3,6 +3,7 @@
 package gocop
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -46,3 +47,20 @@ func TestArgumentSugestor(t *testing.T) {
 	}
 
 }
+
+func TestArgumentSugestor_Quoted(t *testing.T) {
+	wn := NewWorldNode()
+	wn.AddSubCommand("/topic").AddArgument("topic.quoted")
+	*getArgumentAutoSlice("topic.quoted") = []string{"big news", "it's $5"}
+
+	check := func(input string, expected ...string) {
+		sug := wn.SugestAutoComplete(Tokenize(input))
+		t.Logf("Sugestions for %q: %q", input, sug)
+		assertEqual(t, strings.Join(expected, "|"), strings.Join(sug, "|"))
+	}
+
+	check("/topic b", `/topic big\ news`)
+	check("/topic 'big n", `/topic big\ news`)
+	check("/topic it", `/topic it\'s\ \$5`)
+	check("/topic ", `/topic big\ news`, `/topic it\'s\ \$5`)
+}
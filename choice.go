@@ -0,0 +1,119 @@
+// Copyright (c) 2016 Forau @ github.com. MIT License.
+
+package gocop
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Adds an argument that only accepts one of the values. It is completed from the values,
+// and the value from the list is available from both RunContext.Get and RunContext.GetValue.
+func (an *ArgNode) AddChoice(name string, values ...string) *ArgNode {
+	if len(values) == 0 {
+		log.Panic("Need atleast one value for choice ", name)
+	}
+	n := an.AddCustomNode(name, choiceSugestorFn, getTypedInvokerFn(name), typedArgumentAcceptorFn, ArgumentNode)
+	n.ArgType = newChoiceType(values, false)
+	return n
+}
+
+// Lets a choice accept the values in any case
+func (an *ArgNode) IgnoreCase() *ArgNode {
+	if an.ArgType == nil || an.ArgType.Choices == nil {
+		log.Panicf("IgnoreCase is only for choices, not %s", an.Name)
+	}
+	an.ArgType = newChoiceType(an.ArgType.Choices, true)
+	return an
+}
+
+func newChoiceType(values []string, ignoreCase bool) *ArgType {
+	norm := func(s string) string {
+		if ignoreCase {
+			return strings.ToLower(s)
+		}
+		return s
+	}
+	typ := &ArgType{Name: strings.Join(values, "|"), Choices: values}
+	typ.Convert = func(str string) (interface{}, error) {
+		for _, v := range values {
+			if norm(v) == norm(str) {
+				return v, nil
+			}
+		}
+		if near := closeMatches(norm(str), values, norm); len(near) > 0 {
+			return nil, fmt.Errorf("'%s' is not one of %s. Did you mean %s?", str, typ.Name, strings.Join(near, " or "))
+		}
+		return nil, fmt.Errorf("'%s' is not one of %s", str, typ.Name)
+	}
+	typ.Hints = func(partial string) (ret []string) {
+		for _, v := range values {
+			if strings.HasPrefix(norm(v), norm(partial)) {
+				ret = append(ret, v)
+			}
+		}
+		return
+	}
+	return typ
+}
+
+// Sugests from the values only, and not from what was used before
+func choiceSugestorFn(node *ArgNode, in TokenSet) (ret []string) {
+	if len(in) <= 1 {
+		for _, hint := range node.ArgType.Hints(in.Value()) {
+			ret = append(ret, in.config().Quote(hint))
+		}
+	}
+	return
+}
+
+// Returns the values closest to str, if they are close enough to be a typo
+func closeMatches(str string, values []string, norm func(string) string) (ret []string) {
+	best := len(str)/3 + 1 // Allow about one typo per three runes
+	for _, v := range values {
+		d := editDistance(str, norm(v))
+		if strings.HasPrefix(norm(v), str) && str != "" {
+			d = 0 // Only the start was typed, which is the most likely
+		}
+		if d < best {
+			best, ret = d, nil
+		}
+		if d == best {
+			ret = append(ret, v)
+		}
+	}
+	return
+}
+
+// Levenshtein distance between a and b, in runes
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur := make([]int, len(rb)+1)
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(rb)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2016 Forau @ github.com. MIT License.
+
+package gocop
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestEditDistance(t *testing.T) {
+	check := func(a, b string, expected int) {
+		assertEqual(t, fmt.Sprint(expected), fmt.Sprint(editDistance(a, b)))
+	}
+
+	check("", "", 0)
+	check("off", "of", 1)
+	check("auto", "atuo", 2)
+	check("kitten", "sitting", 3)
+	check("åäö", "aäö", 1)
+}
+
+func TestArgNode_AddChoice(t *testing.T) {
+	n := NewWorldNode()
+	n.AddSubCommand("/mode").Handler(func(rc RunContext) (interface{}, error) {
+		return rc.Get("mode") + " " + fmt.Sprint(rc.GetValue("mode")), nil
+	}).AddChoice("mode", "on", "off", "auto")
+	n.AddSubCommand("/log").Handler(func(rc RunContext) (interface{}, error) {
+		return rc.Get("level"), nil
+	}).AddChoice("level", "debug", "info", "warn", "error").IgnoreCase()
+
+	check := func(input, expected string) {
+		res, err := n.InvokeCommand(input, &DefaultRunContext{values: make(map[string]string)})
+		if err != nil {
+			res = strings.Split(err.Error(), "\n")[0]
+		}
+		t.Logf("%q -> %v", input, res)
+		assertEqual(t, expected, fmt.Sprint(res))
+	}
+
+	check("/mode on", "on on")
+	check("/mode auto", "auto auto")
+	check("/mode ON", "Invalid mode: 'ON' is not one of on|off|auto")
+	check("/mode of", "Invalid mode: 'of' is not one of on|off|auto. Did you mean off?")
+	check("/mode atuo", "Invalid mode: 'atuo' is not one of on|off|auto. Did you mean auto?")
+	check("/mode o", "Invalid mode: 'o' is not one of on|off|auto. Did you mean on or off?")
+	check("/mode something", "Invalid mode: 'something' is not one of on|off|auto")
+	check("/log WARN", "warn")
+	check("/log Eror", "Invalid level: 'Eror' is not one of debug|info|warn|error. Did you mean error?")
+
+	usage := strings.Join(n.Usage("", ""), "\n")
+	t.Log(usage)
+	assertEqual(t, "true", fmt.Sprint(strings.Contains(usage, "/mode [mode:on|off|auto]")))
+}
+
+func TestArgNode_AddChoiceSugestions(t *testing.T) {
+	n := NewWorldNode()
+	n.AddSubCommand("/mode").AddChoice("mode.sug", "on", "off", "auto")
+	n.AddSubCommand("/log").AddChoice("level.sug", "Debug", "Info").IgnoreCase()
+	*getArgumentAutoSlice("mode.sug") = []string{"history"} // Not used for choices
+
+	check := func(input string, expected ...string) {
+		sug := n.SugestAutoComplete(Tokenize(input))
+		t.Logf("Sugestions for %q: %q", input, sug)
+		assertEqual(t, strings.Join(expected, "|"), strings.Join(sug, "|"))
+	}
+
+	check("/mode ", "/mode on", "/mode off", "/mode auto")
+	check("/mode o", "/mode on", "/mode off")
+	check("/mode h")
+	check("/log d", "/log Debug")
+}
@@ -0,0 +1,141 @@
+// Copyright (c) 2016 Forau @ github.com. MIT License.
+
+package gocop
+
+import (
+	"fmt"
+	"os"
+)
+
+// Computes the default of an argument. The arguments that were given are available from rc
+type DefaultFn func(rc RunContext) string
+
+// Sets the value used when an optional argument or option is omitted.
+// RunContext.IsDefault tells if the value was defaulted.
+func (an *ArgNode) Default(value string) *ArgNode {
+	return an.DefaultFunc(value, func(rc RunContext) string { return value })
+}
+
+// Like Default, but the value is computed when the command is invoked, like from another argument.
+// The description is shown in usage, like [user?=nick]
+func (an *ArgNode) DefaultFunc(descr string, fn DefaultFn) *ArgNode {
+	an.DefaultDescr, an.defaultFn = descr, fn
+	return an
+}
+
+// Takes the value from the environment variable when the argument or option is omitted, ahead of any default.
+// A mandatory argument can be omitted when the variable is set.
+func (an *ArgNode) FromEnv(variable string) *ArgNode {
+	an.EnvVar = variable
+	oldApFn := an.acceptPermutationsFn
+	an.acceptPermutationsFn = func(node *ArgNode, in TokenSet) (accepted []argNodeAssignment) {
+		accepted = oldApFn(node, in)
+		if _, ok := node.envValue(); ok && node.TypeFlags&OptionalNode == 0 {
+			accepted = append(accepted, node.assignChildNodes(in)...) // Skip self, like an optional node
+		}
+		return
+	}
+	return an
+}
+
+func (an *ArgNode) envValue() (string, bool) {
+	if an.EnvVar == "" {
+		return "", false
+	}
+	return os.LookupEnv(an.EnvVar)
+}
+
+// Checks if the node can be left out. That is, if it is optional, or the value is in the environment
+func (an *ArgNode) omittable() bool {
+	_, env := an.envValue()
+	return env || an.TypeFlags&OptionalNode != 0
+}
+
+// Shows where the value of an omitted node comes from, like $IRC_PORT, ${IRC_PORT:-6667} or 6667.
+// Empty if it has no default.
+func (an *ArgNode) defaultUsage() string {
+	if an.EnvVar != "" && an.defaultFn != nil {
+		return "${" + an.EnvVar + ":-" + an.DefaultDescr + "}"
+	} else if an.EnvVar != "" {
+		return "$" + an.EnvVar
+	}
+	return an.DefaultDescr
+}
+
+// Explains how the mandatory arguments that are missing from the path could be taken from the environment
+func (cap *commandAssignPath) missingFromEnv() (hints []string) {
+	leaf := cap.leaf()
+	missing := leaf.Node.Children
+	if len(leaf.Tokens) == 0 {
+		missing = []*ArgNode{leaf.Node} // The leaf is the missing argument
+	}
+	for _, c := range missing {
+		if c.EnvVar != "" && !c.isOptionalBranch() {
+			hints = append(hints, "Give "+c.Name+", or set "+c.EnvVar)
+		}
+	}
+	return
+}
+
+// Puts the defaults of the omitted nodes in the context, in the order they are defined.
+// Those are the optional nodes skipped between the nodes on the path, the ones after the leaf,
+// and then the flags of the commands on it. Alternatives to a node on the path are not omitted, since it was taken instead.
+func (cap *commandAssignPath) applyDefaults(context RunContext) error {
+	given := make(map[*ArgNode]bool)
+	for _, ass := range *cap {
+		given[ass.Node] = true
+		for _, f := range ass.flags {
+			given[f.Node] = true
+		}
+	}
+
+	var omitted []*ArgNode
+	var skipped func(n *ArgNode)
+	skipped = func(n *ArgNode) {
+		for _, c := range n.Children {
+			if !given[c] && c.omittable() {
+				omitted = append(omitted, c)
+				skipped(c)
+			}
+		}
+	}
+	for idx := 1; idx < len(*cap); idx++ {
+		var between []*ArgNode
+		for n := (*cap)[idx].Node.parent; n != nil && n != (*cap)[idx-1].Node; n = n.parent {
+			between = append([]*ArgNode{n}, between...)
+		}
+		for _, n := range between {
+			if !given[n] && n.omittable() {
+				omitted = append(omitted, n)
+			}
+		}
+	}
+	skipped(cap.leaf().Node)
+	for _, ass := range *cap {
+		for _, f := range ass.Node.Flags {
+			if !given[f] {
+				omitted = append(omitted, f) // After the arguments, since options often default to one of them
+			}
+		}
+	}
+
+	for _, n := range omitted {
+		value, ok := n.envValue()
+		if !ok && n.defaultFn == nil {
+			continue
+		} else if !ok {
+			value = n.defaultFn(context)
+		}
+		if n.ArgType != nil {
+			v, err := n.ArgType.Convert(value)
+			if err != nil {
+				return fmt.Errorf("Invalid default for %s: %s", n.Name, err) // The message from Convert names the value
+			} else if str, ok := v.(string); ok {
+				value = str // Like the value from a choice, which may differ in case
+			}
+			context.PutValue(n.Name, typedValue(n, []interface{}{v}))
+		}
+		context.PutDefault(n.Name, value)
+	}
+	return nil
+}
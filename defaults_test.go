@@ -0,0 +1,101 @@
+// Copyright (c) 2016 Forau @ github.com. MIT License.
+
+package gocop
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestArgNode_Default(t *testing.T) {
+	n := NewWorldNode()
+	connect := n.AddSubCommand("/connect").Handler(func(rc RunContext) (interface{}, error) {
+		return fmt.Sprintf("%s:%v(%v) nick=%s(%v) user=%s(%v) tls=%s", rc.Get("server"), rc.GetValue("port"), rc.IsDefault("port"),
+			rc.Get("nick"), rc.IsDefault("nick"), rc.Get("user"), rc.IsDefault("user"), rc.Get("tls")), nil
+	})
+	connect.AddOption("user", 'u').DefaultFunc("nick", func(rc RunContext) string { return rc.Get("nick") })
+	connect.AddFlag("tls", 0)
+	connect.AddArgument("server").AddIntArgument("port").Optional().Default("6667").
+		AddArgument("nick").Optional().Default("guest")
+	n.AddSubCommand("/bad").Handler(func(rc RunContext) (interface{}, error) {
+		return nil, nil
+	}).AddIntArgument("num").Optional().Default("ten")
+	alt := n.AddSubCommand("/alt").Handler(func(rc RunContext) (interface{}, error) {
+		return fmt.Sprintf("alt=%s(%v)", rc.Get("alt"), rc.IsDefault("alt")), nil
+	})
+	alt.AddArgument("alt").Optional().Default("A")
+	alt.AddSubCommand("sub").Handler(func(rc RunContext) (interface{}, error) {
+		return fmt.Sprintf("alt=%s(%v) level=%s", rc.Get("alt"), rc.IsDefault("alt"), rc.Get("level")), nil
+	}).AddArgument("level").Optional().Default("1")
+
+	check := func(input, expected string) {
+		res, err := n.InvokeCommand(input, &DefaultRunContext{values: make(map[string]string)})
+		if err != nil {
+			res = strings.Split(err.Error(), "\n")[0]
+		}
+		t.Logf("%q -> %v", input, res)
+		assertEqual(t, expected, fmt.Sprint(res))
+	}
+
+	check("/connect srv", "srv:6667(true) nick=guest(true) user=guest(true) tls=")
+	check("/connect srv 7000", "srv:7000(false) nick=guest(true) user=guest(true) tls=")
+	check("/connect srv 6667 bob", "srv:6667(false) nick=bob(false) user=bob(true) tls=")
+	check("/connect srv bob -u alice", "srv:6667(true) nick=bob(false) user=alice(false) tls=")
+	check("/bad", "Invalid default for num: 'ten' is not a number")
+	check("/alt", "alt=A(true)")
+	check("/alt sub", "alt=(false) level=1")
+	check("/alt sub 5", "alt=(false) level=5")
+
+	usage := strings.Join(n.Usage("", ": "), "\n")
+	t.Log(usage)
+	assertEqual(t, " /connect [-u|--user=user?=nick] [--tls] [server] [port:int?=6667] [nick?=guest]",
+		strings.Split(usage, "\n")[0])
+}
+
+func TestDefaultRunContext_IsDefault(t *testing.T) {
+	rc := &DefaultRunContext{values: make(map[string]string)}
+	assertEqual(t, "false", fmt.Sprint(rc.IsDefault("name")))
+	rc.PutDefault("name", "default")
+	assertEqual(t, "true", fmt.Sprint(rc.IsDefault("name")))
+	rc.Put("name", "given")
+	assertEqual(t, "false given", fmt.Sprint(rc.IsDefault("name"), " ", rc.Get("name")))
+}
+
+func TestArgNode_FromEnv(t *testing.T) {
+	os.Setenv("GOCOP_TEST_PORT", "7000")
+	os.Unsetenv("GOCOP_TEST_SERVER")
+	defer os.Unsetenv("GOCOP_TEST_SERVER")
+	defer os.Unsetenv("GOCOP_TEST_PORT")
+
+	n := NewWorldNode()
+	n.AddSubCommand("/connect").Handler(func(rc RunContext) (interface{}, error) {
+		return fmt.Sprintf("%s(%v):%v(%v) nick=%s", rc.Get("server"), rc.IsDefault("server"),
+			rc.GetValue("port"), rc.IsDefault("port"), rc.Get("nick")), nil
+	}).AddArgument("server").FromEnv("GOCOP_TEST_SERVER").
+		AddIntArgument("port").Optional().Default("6667").FromEnv("GOCOP_TEST_PORT").
+		AddArgument("nick").Optional().Default("guest").FromEnv("GOCOP_TEST_NICK")
+
+	check := func(input, expected string) {
+		res, err := n.InvokeCommand(input, &DefaultRunContext{values: make(map[string]string)})
+		if err != nil {
+			res = strings.Split(err.Error(), "\n")[0]
+		}
+		t.Logf("%q -> %v", input, res)
+		assertEqual(t, expected, fmt.Sprint(res))
+	}
+
+	check("/connect srv", "srv(false):7000(true) nick=guest")
+	check("/connect srv 8000 bob", "srv(false):8000(false) nick=bob")
+	check("/connect", "Missing argument for: /connect. Give server, or set GOCOP_TEST_SERVER")
+	check("/connect ", "Missing argument for: /connect. Give server, or set GOCOP_TEST_SERVER")
+
+	os.Setenv("GOCOP_TEST_SERVER", "env.srv")
+	check("/connect", "env.srv(true):7000(true) nick=guest")
+	check("/connect srv", "srv(false):7000(true) nick=guest")
+
+	usage := strings.Join(n.Usage("", ": "), "\n")
+	t.Log(usage)
+	assertEqual(t, " /connect [server=$GOCOP_TEST_SERVER] [port:int?=${GOCOP_TEST_PORT:-6667}] [nick?=${GOCOP_TEST_NICK:-guest}]", usage)
+}
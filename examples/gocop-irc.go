@@ -107,16 +107,9 @@ func (ic *IrcConn) SendRaw(data string) {
 
 func (ic *IrcConn) Connect(rc gocop.RunContext) (interface{}, error) {
 	nick := rc.Get("nick")
-	user := rc.Get("user")
+	user := rc.Get("user") // Defaults to nick
 	if nick == "" {
-		if ic.nick == "" {
-			return nil, fmt.Errorf("Please set nick. Can add it after server on /connect")
-		} else {
-			nick = ic.nick
-		}
-	}
-	if user == "" {
-		user = nick
+		return nil, fmt.Errorf("Please set nick. Can add it after server on /connect")
 	}
 
 	conn, err := net.DialTimeout("tcp", rc.Get("server"), time.Second*30)
@@ -194,18 +187,22 @@ func main() {
 
 	world := cp.NewWorld()
 	world.AddSubCommand("/nick").Handler(irc.SetNick).AddArgument("nick")
-	world.AddSubCommand("/connect").Handler(irc.Connect).AddArgument("server").AddArgument("nick").Optional().AddArgument("user").Optional()
-	world.AddSubCommand("/raw").AddArgument("data").Times(1, 999).Handler(func(rc gocop.RunContext) (res interface{}, err error) {
+	connect := world.AddSubCommand("/connect").Handler(irc.Connect)
+	connect.AddOption("user", 'u').Description("User name, if not the same as nick").
+		DefaultFunc("nick", func(rc gocop.RunContext) string { return rc.Get("nick") })
+	connect.AddArgument("server").FromEnv("IRC_SERVER").AddArgument("nick").Optional().FromEnv("IRC_NICK").
+		DefaultFunc("nick from /nick", func(rc gocop.RunContext) string { return irc.nick })
+	world.AddSubCommand("/raw").AddRest("data").Handler(func(rc gocop.RunContext) (res interface{}, err error) {
 		irc.SendRaw(rc.Get("data"))
 		return
 	})
 
-	world.AddSubCommand("/join").AddArgument("channel").Times(1, 2).Handler(func(rc gocop.RunContext) (res interface{}, err error) {
+	world.AddSubCommand("/join").Alias("/j").AddArgument("channel").Times(1, 2).Handler(func(rc gocop.RunContext) (res interface{}, err error) {
 		irc.SendRaw("JOIN " + rc.Get("channel"))
 		return
 	})
 
-	world.AddSubCommand("/msg").AddArgument("user").AddArgument("message").Times(1, 999).Handler(func(rc gocop.RunContext) (res interface{}, err error) {
+	world.AddSubCommand("/msg").AddArgument("user").AddRest("message").Handler(func(rc gocop.RunContext) (res interface{}, err error) {
 		irc.SendRaw("PRIVMSG " + rc.Get("user") + " :" + rc.Get("message"))
 		return
 	})
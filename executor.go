@@ -0,0 +1,285 @@
+// Copyright (c) 2016 Forau @ github.com. MIT License.
+
+package gocop
+
+import (
+	"strings"
+)
+
+// A command in a line, and the operator that comes before it
+type commandSegment struct {
+	op     *Token   // The operator before the segment. nil for the first one
+	tokens TokenSet // The command, without leading whitespaces
+	rest   bool     // If the command ends with a rest argument, that took the operators after it
+}
+
+// A command that is ready to run
+type preparedCommand struct {
+	path     commandAssignPath
+	redirect *redirect
+}
+
+// Checks if the segment is preceded by the operator
+func (seg *commandSegment) after(op string) bool {
+	return seg.op != nil && seg.op.val == op
+}
+
+// Splits the tokens into segments on the operators. Redirects are part of the segment.
+// If takesRest is true for the tokens of a segment, and the rest of the line, the rest is one segment.
+func splitSegments(ts TokenSet, takesRest func(TokenSet) bool) (segs []commandSegment) {
+	seg := commandSegment{}
+	start := 0
+	for idx := range ts {
+		if idx == start && takesRest != nil && hasOperator(ts[start:]) && takesRest(trimLeadingWhitespace(ts[start:])) {
+			seg.rest = true
+			break
+		}
+		if ts[idx].Type == TokenOperator && !isRedirect(&ts[idx]) {
+			seg.tokens = trimLeadingWhitespace(ts[start:idx])
+			segs = append(segs, seg)
+			seg = commandSegment{op: &ts[idx]}
+			start = idx + 1
+		}
+	}
+	seg.tokens = trimLeadingWhitespace(ts[start:])
+	return append(segs, seg)
+}
+
+func hasOperator(ts TokenSet) bool {
+	return firstOperator(ts) != nil
+}
+
+// Removes leading whitespaces and comments, but keeps EOF, since it tells autocomplete that we want a new argument
+func trimLeadingWhitespace(ts TokenSet) TokenSet {
+	for len(ts) > 0 && ts[0].Type&(TokenWhitespace|TokenComment) != 0 {
+		ts = ts[1:]
+	}
+	return ts
+}
+
+// Only ; is allowed to have nothing after it, and no operator can have nothing before it
+func checkSegments(line string, segs []commandSegment) error {
+	for idx, seg := range segs {
+		if seg.tokens.HasText() {
+			continue
+		}
+		if idx+1 < len(segs) {
+			op := segs[idx+1].op
+			return &InvalidArgument{msg: "Missing command before: " + op.val, input: line, Span: op.Span()}
+		} else if seg.op != nil && seg.op.val != ";" {
+			return &InvalidArgument{msg: "Missing command after: " + seg.op.val, input: line, Span: seg.op.Span()}
+		}
+	}
+	return nil
+}
+
+// Groups the segments into pipelines, where each segment after | is added to the previous pipeline
+func splitPipelines(segs []commandSegment) (pipes [][]commandSegment) {
+	for _, seg := range segs {
+		if seg.after("|") {
+			pipes[len(pipes)-1] = append(pipes[len(pipes)-1], seg)
+		} else {
+			pipes = append(pipes, []commandSegment{seg})
+		}
+	}
+	return
+}
+
+// Returned when a command substitution fails. Both the outer and the inner command are reported.
+type SubstitutionError struct {
+	Outer, Inner string
+	Err          error
+}
+
+func (se *SubstitutionError) Error() string {
+	return "Command substitution $(" + se.Inner + ") failed in: " + se.Outer + "\n" + se.Err.Error()
+}
+
+// Returns the marker from the inner error, if it has one
+func (se *SubstitutionError) Marker() string {
+	if m, ok := se.Err.(interface {
+		Marker() string
+	}); ok {
+		return m.Marker()
+	}
+	return ""
+}
+
+// Tokenizes the line with the parsers lexer rules, expands variables, and invokes the commands in it.
+// Each command is expanded just before it runs, so it sees the variables set by the commands before it.
+// Commands can be chained with ;, && and ||, where && only runs if the previous command succeeded, and || only if it failed.
+// With |, the result of a command is available to the next through RunContext.Input.
+// With > or >>, the rendered result is written to a file instead.
+// With $(cmd), the rendered result of cmd is used as a single argument.
+// It runs when the command it is in is about to run, so not if && or || skips that command.
+// The results of all but the last command are passed to the ResultHandler, and the last one is returned.
+func (cp *CommandParser) Execute(line string) (res interface{}, err error) {
+	return cp.execute(line, cp.ResultHandler)
+}
+
+// Runs a command substitution, and renders the results of the commands, without trailing linebreaks
+func (cp *CommandParser) substitute(outer, inner string) (string, error) {
+	out := []string{}
+	collect := func(res interface{}, err error) {
+		if w, ok := res.(Warning); ok {
+			cp.ResultHandler(w, nil) // Not a part of the output
+		} else if err == nil && res != nil {
+			out = append(out, cp.Renderer(res))
+		}
+	}
+	res, err := cp.execute(inner, collect)
+	if err != nil {
+		return "", &SubstitutionError{Outer: outer, Inner: inner, Err: err}
+	}
+	collect(res, nil)
+	return strings.TrimRight(strings.Join(out, "\n"), "\n"), nil
+}
+
+func (cp *CommandParser) execute(line string, report ResultHandlerFn) (res interface{}, err error) {
+	exp := &expander{lookup: cp.Vars.Lookup, braces: true, subst: func(inner string) (string, error) {
+		return cp.substitute(line, inner)
+	}}
+	tokens := cp.Lexer.Tokenize(line)
+	if err = tokens.Err(); err != nil {
+		return
+	}
+	if tokens, err = bindHeredocs(line, tokens); err != nil {
+		return
+	}
+	segs := splitSegments(tokens, cp.takesRest)
+	if err = checkSegments(line, segs); err != nil {
+		return
+	}
+
+	ran := false
+	for _, pipe := range splitPipelines(segs) {
+		first := &pipe[0]
+		if !first.tokens.HasText() || (first.after("&&") && err != nil) || (first.after("||") && err == nil) {
+			continue
+		}
+		if ran {
+			report(res, err)
+		}
+		ran = true
+		// Expanded just before it runs, so it sees the variables set by the commands before it,
+		// and the substitutions of a skipped pipeline are never run
+		if pipe, err = cp.expandPipeline(exp, pipe); err != nil {
+			res = nil
+			continue
+		}
+		res, err = cp.runPipeline(line, pipe, report)
+	}
+	return
+}
+
+// Returns the pipeline with the segments expanded. The input is not modified
+func (cp *CommandParser) expandPipeline(exp *expander, pipe []commandSegment) (ret []commandSegment, err error) {
+	ret = make([]commandSegment, len(pipe))
+	for idx := range pipe {
+		if ret[idx], err = cp.expandSegment(exp, pipe[idx]); err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+// Expands the variables and braces, but not substitutions, since they could have side effects
+func (cp *CommandParser) dryExpand(tokens TokenSet) TokenSet {
+	dry, _ := (&expander{lookup: cp.Vars.Lookup, braces: true}).expand(tokens)
+	return dry
+}
+
+// Like ArgNode.takesRest, but for tokens that are not expanded yet
+func (cp *CommandParser) takesRest(tokens TokenSet) bool {
+	return cp.world.takesRest(cp.dryExpand(tokens))
+}
+
+// Expands the tokens of the segment, except the ones taken by a rest argument, since they are used as typed.
+// We find the rest argument with dryExpand, so no substitution is run for it.
+func (cp *CommandParser) expandSegment(exp *expander, seg commandSegment) (commandSegment, error) {
+	head, rest := seg.tokens, TokenSet(nil)
+	if dry := cp.dryExpand(seg.tokens); dry.HasText() {
+		if start := cp.world.restStart(dry); start >= 0 {
+			for idx := range seg.tokens {
+				if seg.tokens[idx].Pos >= start {
+					head, rest = seg.tokens[:idx:idx], seg.tokens[idx:]
+					break
+				}
+			}
+		}
+	}
+	head, err := exp.expand(head)
+	if err != nil {
+		return seg, err
+	}
+	seg.tokens = append(head, rest...)
+	return seg, nil
+}
+
+// Runs the commands in order, with the result of each one as input to the next.
+// All commands are assigned before any is run, so a bad command will not leave the pipeline half done.
+// A redirected command writes its result to the file, and passes on nil.
+// Warnings, like for deprecated commands, are reported before the command runs.
+func (cp *CommandParser) runPipeline(line string, pipe []commandSegment, report ResultHandlerFn) (res interface{}, err error) {
+	cmds := make([]preparedCommand, len(pipe))
+	for idx, seg := range pipe {
+		tokens := seg.tokens
+		if !seg.rest { // Otherwise the redirect is part of the rest argument
+			if tokens, cmds[idx].redirect, err = extractRedirect(line, seg.tokens); err != nil {
+				return
+			}
+		}
+		if cmds[idx].path, err = cp.world.assignTokens(tokens); err != nil {
+			if ia, ok := err.(*InvalidArgument); ok {
+				// The tokens have a gap where the redirect was, so we show the segment as it was typed
+				ia.input, ia.offset = seg.tokens.String(), seg.tokens[0].Pos
+			}
+			return
+		}
+		if idx > 0 && !cmds[idx].path.acceptsInput() {
+			return nil, &InvalidArgument{msg: "Command does not accept piped input: " + cmds[idx].path[0].Node.Name,
+				input: line, Span: seg.tokens.Span()}
+		}
+	}
+
+	for idx, cmd := range cmds {
+		rc := cp.NewRunContext()
+		if idx > 0 {
+			rc.SetInput(res)
+		}
+		for _, w := range cmd.path.warnings() {
+			report(w, nil)
+		}
+		if res, err = cmd.path.Invoke(rc); err != nil {
+			return
+		}
+		if cmd.redirect != nil {
+			if err = cmd.redirect.write(res, cp.Renderer); err != nil {
+				return
+			}
+			res = nil
+		}
+	}
+	return
+}
+
+// Autocompletes the last command in the line
+func (cp *CommandParser) completeSegment(tokens TokenSet) (ret []string) {
+	segs := splitSegments(tokens, cp.world.takesRest)
+	last := segs[len(segs)-1].tokens
+	if len(last) == 0 {
+		return
+	}
+	prefix := tokens.String()[:last[0].Pos-tokens[0].Pos]
+	if cmd, partial, ok := redirectTarget(last); ok {
+		prefix += cmd.String()
+		for _, sug := range cp.Lexer.completeFile(partial) {
+			ret = append(ret, prefix+sug)
+		}
+		return
+	}
+	for _, sug := range cp.world.SugestAutoComplete(last) {
+		ret = append(ret, prefix+sug)
+	}
+	return
+}
@@ -0,0 +1,231 @@
+// Copyright (c) 2016 Forau @ github.com. MIT License.
+
+package gocop
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// Creates a parser with ok and fail commands, that logs what is run and reported
+func newTestParser(log *[]string) *CommandParser {
+	cp := NewCommandParser()
+	cp.ResultHandler = func(res interface{}, err error) {
+		*log = append(*log, fmt.Sprintf("result(%v, %v)", res, err))
+	}
+	world := cp.NewWorld()
+	world.AddSubCommand("ok").AddArgument("name").Handler(func(rc RunContext) (interface{}, error) {
+		*log = append(*log, "ok "+rc.Get("name"))
+		return rc.Get("name"), nil
+	})
+	world.AddSubCommand("fail").AddArgument("name").Handler(func(rc RunContext) (interface{}, error) {
+		*log = append(*log, "fail "+rc.Get("name"))
+		return nil, errors.New(rc.Get("name"))
+	})
+	world.AddSubCommand("/join").AddArgument("channel")
+	world.AddSubCommand("/msg").AddArgument("user").AddArgument("message").Times(1, 99)
+	return cp
+}
+
+func TestCommandParser_ExecuteChain(t *testing.T) {
+	check := func(line, expected string) {
+		log := []string{}
+		cp := newTestParser(&log)
+		res, err := cp.Execute(line)
+		log = append(log, fmt.Sprintf("return(%v, %v)", res, err))
+		assertEqual(t, expected, strings.Join(log, "; "))
+	}
+
+	check("ok a", "ok a; return(a, <nil>)")
+	check("ok a; ok b", "ok a; result(a, <nil>); ok b; return(b, <nil>)")
+	check("ok a;ok b;", "ok a; result(a, <nil>); ok b; return(b, <nil>)")
+	check("fail a && ok b", "fail a; return(<nil>, a)")
+	check("ok a&&ok b", "ok a; result(a, <nil>); ok b; return(b, <nil>)")
+	check("fail a || ok b", "fail a; result(<nil>, a); ok b; return(b, <nil>)")
+	check("ok a || ok b", "ok a; return(a, <nil>)")
+	check("fail a && ok b || ok c", "fail a; result(<nil>, a); ok c; return(c, <nil>)")
+	check("ok a || ok b && ok c", "ok a; result(a, <nil>); ok c; return(c, <nil>)")
+	check("ok 'a;b' && ok a\\&\\&b", "ok a;b; result(a;b, <nil>); ok a&&b; return(a&&b, <nil>)")
+	// Each command is expanded just before it runs, so it sees the variables set before it
+	check("set v one; ok $v", "result(<nil>, <nil>); ok one; return(one, <nil>)")
+	check("set v {a,b} && ok $v", "result(<nil>, <nil>); ok a b; return(a b, <nil>)")
+	// Substitutions run when their command does, and not at all if it is skipped
+	check("fail a && ok $(ok x)", "fail a; return(<nil>, a)")
+	check("ok a || ok $(ok x)", "ok a; return(a, <nil>)")
+	check("ok a; ok $(ok b)", "ok a; result(a, <nil>); ok b; ok b; return(b, <nil>)")
+	check("ok $(fail x); ok b", "fail x; result(<nil>, Command substitution $(fail x) failed in: ok $(fail x); ok b\nx); ok b; return(b, <nil>)")
+}
+
+func TestCommandParser_ExecuteChainErrors(t *testing.T) {
+	check := func(line, expMarker string, expRun int) {
+		log := []string{}
+		_, err := newTestParser(&log).Execute(line)
+		if ia, ok := err.(*InvalidArgument); !ok {
+			t.Errorf("Expected InvalidArgument for '%s', but got %v", line, err)
+		} else {
+			assertEqual(t, expMarker, ia.Marker())
+		}
+		if len(log) != expRun {
+			t.Error("Expected ", expRun, " lines in log, but got ", log)
+		}
+	}
+
+	check("&& ok a", "&& ok a\n^~\n", 0)
+	check("ok a ;; ok b", "ok a ;; ok b\n      ^\n", 0)
+	check("ok a ||", "ok a ||\n     ^~\n", 0)
+	check("ok a; ok b c", "ok b c\n     ^\n", 2) // Only the failing command is marked
+
+	_, err := newTestParser(&[]string{}).Execute("ok a; ok \x7f")
+	if le, ok := err.(*LexicalError); !ok {
+		t.Error("Expected LexicalError, but got ", err)
+	} else {
+		assertEqual(t, "ok a; ok \x7f\n         ^\n", le.Marker())
+	}
+
+}
+
+func TestCommandParser_AutoCompleteSegment(t *testing.T) {
+	log := []string{}
+	cp := newTestParser(&log)
+
+	sug := cp.AutoCompleter("/join #a && /ms")
+	if len(sug) != 1 || sug[0] != "/join #a && /msg" {
+		t.Error("Expected '/join #a && /msg' but got ", sug)
+	}
+	sug = cp.AutoCompleter("/join #a;/jo")
+	if len(sug) != 1 || sug[0] != "/join #a;/join" {
+		t.Error("Expected '/join #a;/join' but got ", sug)
+	}
+	sug = cp.AutoCompleter("/join \x00#a;/jo")
+	if len(sug) != 0 {
+		t.Error("Expected no sugestions for malformed input, but got ", sug)
+	}
+}
+
+func TestCommandParser_ExecutePipeline(t *testing.T) {
+	log := []string{}
+	cp := newTestParser(&log)
+	world := cp.world
+	world.AddSubCommand("users").Handler(func(rc RunContext) (interface{}, error) {
+		return []string{"alice", "bob"}, nil
+	})
+	world.AddSubCommand("msgeach").AcceptsInput().AddArgument("message").Handler(func(rc RunContext) (interface{}, error) {
+		users, ok := rc.Input().([]string)
+		if !ok {
+			return nil, fmt.Errorf("Expected a list of users, but got %v", rc.Input())
+		}
+		sent := []string{}
+		for _, u := range users {
+			sent = append(sent, u+":"+rc.Get("message"))
+		}
+		return sent, nil
+	})
+	world.AddSubCommand("count").AcceptsInput().Handler(func(rc RunContext) (interface{}, error) {
+		return len(rc.Input().([]string)), nil
+	})
+
+	res, err := cp.Execute("users | msgeach hi")
+	assertEqual(t, "[alice:hi bob:hi] <nil>", fmt.Sprint(res, " ", err))
+
+	res, err = cp.Execute("users|msgeach hi|count")
+	assertEqual(t, "2 <nil>", fmt.Sprint(res, " ", err))
+
+	res, err = cp.Execute("msgeach hi")
+	assertEqual(t, "<nil> Expected a list of users, but got <nil>", fmt.Sprint(res, " ", err))
+
+	res, err = cp.Execute("fail x | count || users | count")
+	assertEqual(t, "2 <nil>", fmt.Sprint(res, " ", err))
+
+	log = log[:0]
+	_, err = cp.Execute("users | ok a")
+	if ia, ok := err.(*InvalidArgument); !ok || !strings.Contains(ia.msg, "does not accept piped input: ok") {
+		t.Error("Expected error about piped input, but got ", err)
+	} else {
+		assertEqual(t, "users | ok a\n        ^~~~\n", ia.Marker())
+	}
+	if len(log) != 0 {
+		t.Error("Expected nothing to run when the pipeline is invalid, but got ", log)
+	}
+}
+
+func TestCommandParser_ExecuteSubstitution(t *testing.T) {
+	log := []string{}
+	cp := newTestParser(&log)
+	cp.world.AddSubCommand("whoami").Handler(func(rc RunContext) (interface{}, error) {
+		return "Forau\n", nil
+	})
+	cp.world.AddSubCommand("echo").AddArgument("text").Times(1, 99).Handler(func(rc RunContext) (interface{}, error) {
+		return rc.Get("text"), nil
+	})
+
+	check := func(line, expected string) {
+		res, err := cp.Execute(line)
+		assertEqual(t, expected, fmt.Sprint(res, " ", err))
+	}
+
+	check("ok $(whoami)", "Forau <nil>")
+	check("ok $(echo two words)", "two words <nil>")
+	check("ok x$(echo a;echo b)y", "xa\nby <nil>")
+	check(`ok "[$(echo "inner quoted" $(echo nested))]"`, "[inner quoted nested] <nil>")
+	check(`ok '$(whoami)'`, "$(whoami) <nil>")
+	check(`ok \$(whoami)`, "$(whoami) <nil>")
+	check(`ok $(echo ')')`, ") <nil>")
+
+	log = log[:0]
+	_, err := cp.Execute("ok $(fail inner) && ok after")
+	if se, ok := err.(*SubstitutionError); !ok {
+		t.Error("Expected SubstitutionError, but got ", err)
+	} else {
+		assertEqual(t, "ok $(fail inner) && ok after", se.Outer)
+		assertEqual(t, "fail inner", se.Inner)
+		assertEqual(t, "inner", se.Err.Error())
+	}
+	assertEqual(t, "fail inner", strings.Join(log, "; "))
+
+	_, err = cp.Execute("ok $(unknown cmd)")
+	if se, ok := err.(*SubstitutionError); !ok || se.Marker() != "unknown cmd\n^~~~~~~\n" {
+		t.Errorf("Expected SubstitutionError with marker, but got %#v", err)
+	}
+
+	if !Tokenize("ok $(echo 'a b'").NeedsContinuation() || len(Tokenize("ok $(echo a b) c").Filter(TokenNoWhitespace)) != 3 {
+		t.Error("Expected substitutions to be scanned as part of the argument")
+	}
+}
+
+func TestCommandParser_ExecuteRest(t *testing.T) {
+	log := []string{}
+	cp := newTestParser(&log)
+	cp.Vars.Set("user", "bob")
+	cp.world.AddSubCommand("/say").AddArgument("user").AddRest("message").Handler(func(rc RunContext) (interface{}, error) {
+		log = append(log, "say "+rc.Get("user")+": "+rc.Get("message"))
+		return nil, nil
+	})
+
+	check := func(line, expected string) {
+		log = log[:0]
+		if _, err := cp.Execute(line); err != nil {
+			log = append(log, err.Error())
+		}
+		assertEqual(t, expected, strings.Join(log, "; "))
+	}
+
+	check("/say $user hi; ok x | y > z", "say bob: hi; ok x | y > z")
+	check("ok a && /say $user {1,2}  $user", "ok a; result(a, <nil>); say bob: {1,2}  $user")
+	check("/say bob <<EOF\nline 1\n  line 2\nEOF", "say bob: line 1\n  line 2")
+	check("ok a; ok b", "ok a; result(a, <nil>); ok b")
+	// Substitutions in the rest are not run, but the ones before it are
+	check("/say bob hi $(ok side-effect)", "say bob: hi $(ok side-effect)")
+	check("/say bob hi $(fail boom) && ok x", "say bob: hi $(fail boom) && ok x")
+	check("/say $(ok bob) hi $(ok no)", "ok bob; say bob: hi $(ok no)")
+
+	sug := cp.AutoCompleter("/say bob hi; /jo")
+	if len(sug) != 0 {
+		t.Error("Expected no sugestions inside the rest argument, but got ", sug)
+	}
+	sug = cp.AutoCompleter("ok a; /sa")
+	if len(sug) != 1 || sug[0] != "ok a; /say" {
+		t.Error("Expected 'ok a; /say' but got ", sug)
+	}
+}
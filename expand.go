@@ -0,0 +1,329 @@
+// Copyright (c) 2016 Forau @ github.com. MIT License.
+
+package gocop
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Runs the command in a command substitution, and returns the rendered result
+type substituteFn func(cmd string) (string, error)
+
+// Decides what to expand in the tokens
+type expander struct {
+	lookup VarLookupFn  // Expands $VAR and ${VAR}. nil to keep them as they are
+	subst  substituteFn // Runs $(cmd). nil to keep them as they are
+	braces bool         // Expands {a,b} and {1..5} into several tokens
+}
+
+// Brace expansions generating more words than this are not expanded
+const maxBraceExpansion = 10000
+
+// Separates the tokens generated by brace or glob expansion
+var expansionSeparator = " "
+
+// Returns the position after the ) that matches a $(, where pos is right after the $(
+func (cfg *LexerConfig) substitutionEnd(str string, pos int) (int, bool) {
+	s := cfg.newScanner(str, pos, 0, nil)
+	ok := s.skipSubstitution()
+	return s.pos, ok
+}
+
+// Returns the position after the escape, $(...) or ${...} at pos, or pos if there is none of them
+func (cfg *LexerConfig) skipUnexpandable(str string, pos int) int {
+	r, w := utf8.DecodeRuneInString(str[pos:])
+	if r == cfg.Escape && r != 0 && pos+w < len(str) {
+		_, w2 := utf8.DecodeRuneInString(str[pos+w:])
+		return pos + w + w2
+	} else if strings.HasPrefix(str[pos:], "$(") {
+		if end, ok := cfg.substitutionEnd(str, pos+2); ok {
+			return end
+		}
+	} else if strings.HasPrefix(str[pos:], "${") {
+		if end := strings.IndexByte(str[pos:], '}'); end > 0 {
+			return pos + end + 1
+		}
+	}
+	return pos
+}
+
+// Finds the } that matches the { at open, and the positions of the commas directly inside it.
+// Returns -1 if there is no match.
+func (cfg *LexerConfig) matchBrace(str string, open int) (end int, commas []int) {
+	depth := 0
+	for i := open; i < len(str); {
+		if skip := cfg.skipUnexpandable(str, i); skip > i {
+			i = skip
+			continue
+		}
+		switch str[i] {
+		case '{':
+			depth++
+		case '}':
+			if depth--; depth == 0 {
+				return i, commas
+			}
+		case ',':
+			if depth == 1 {
+				commas = append(commas, i)
+			}
+		}
+		i++
+	}
+	return -1, nil
+}
+
+// Expands a sequence like 1..5, -2..2..2, 01..10 or a..e. Returns nil if it is not a sequence.
+func expandSequence(str string) []string {
+	parts := strings.Split(str, "..")
+	if len(parts) < 2 || len(parts) > 3 {
+		return nil
+	}
+	step := 1
+	if len(parts) == 3 {
+		var err error
+		if step, err = strconv.Atoi(parts[2]); err != nil || step == 0 {
+			return nil
+		}
+		if step < 0 {
+			step = -step
+		}
+		if step < 0 {
+			return nil // The smallest int has no positive
+		}
+	}
+
+	isLetter := func(s string) bool {
+		return len(s) == 1 && ((s[0] >= 'a' && s[0] <= 'z') || (s[0] >= 'A' && s[0] <= 'Z'))
+	}
+	var from, to, width int
+	letters := isLetter(parts[0]) && isLetter(parts[1])
+	if letters {
+		from, to = int(parts[0][0]), int(parts[1][0])
+	} else {
+		var err1, err2 error
+		from, err1 = strconv.Atoi(parts[0])
+		to, err2 = strconv.Atoi(parts[1])
+		if err1 != nil || err2 != nil {
+			return nil
+		}
+		for _, p := range parts[:2] {
+			if strings.HasPrefix(strings.TrimPrefix(p, "-"), "0") && len(p) > width {
+				width = len(p) // Zero padded, so pad all to the widest
+			}
+		}
+	}
+
+	// The distance can be larger than the largest int, like from -1 to the largest int, so we count in uint64
+	dist, ustep := uint64(to)-uint64(from), uint64(step)
+	if to < from {
+		dist, step = uint64(from)-uint64(to), -step
+	}
+	if dist/ustep >= maxBraceExpansion {
+		return nil
+	}
+	count := int(dist/ustep) + 1
+	var ret []string
+	for n, i := 0, from; n < count; n, i = n+1, i+step { // Counted, so i does not wrap after the last one
+		if letters {
+			ret = append(ret, string(rune(i)))
+		} else if num := strconv.Itoa(i); width > 0 {
+			sign := ""
+			if i < 0 {
+				sign, num = "-", num[1:]
+			}
+			for len(sign)+len(num) < width {
+				num = "0" + num
+			}
+			ret = append(ret, sign+num)
+		} else {
+			ret = append(ret, num)
+		}
+	}
+	return ret
+}
+
+// Expands {a,b} and {1..5} in the raw text of a unquoted word. Escaped braces, and braces in $(...) or ${...}
+// are left alone. Returns nil if there was nothing to expand.
+func (cfg *LexerConfig) expandBraces(str string) []string {
+	for open := 0; open < len(str); open++ {
+		if skip := cfg.skipUnexpandable(str, open); skip > open {
+			open = skip - 1
+			continue
+		} else if str[open] != '{' {
+			continue
+		}
+		end, commas := cfg.matchBrace(str, open)
+		if end < 0 {
+			continue
+		}
+
+		var alts []string
+		if len(commas) > 0 {
+			start := open + 1
+			for _, c := range append(commas, end) {
+				alts = append(alts, str[start:c])
+				start = c + 1
+			}
+		} else if alts = expandSequence(str[open+1 : end]); alts == nil {
+			continue
+		}
+
+		posts := cfg.expandBraces(str[end+1:])
+		if posts == nil {
+			posts = []string{str[end+1:]}
+		}
+		var ret []string
+		for _, alt := range alts {
+			altExp := cfg.expandBraces(alt)
+			if altExp == nil {
+				altExp = []string{alt}
+			}
+			for _, a := range altExp {
+				for _, p := range posts {
+					ret = append(ret, str[:open]+a+p)
+				}
+			}
+			if len(ret) > maxBraceExpansion {
+				return nil
+			}
+		}
+		return ret
+	}
+	return nil
+}
+
+// Expands $VAR, ${VAR} and $(cmd) in str, and decodes escapes, but not in the expanded values.
+// An escaped $ is not expanded. Returns false if there was nothing to expand.
+func (e *expander) expandWord(cfg *LexerConfig, str string) (string, bool, error) {
+	var buf bytes.Buffer
+	changed := false
+	lit := 0 // Start of the literal text we have not written yet
+	for i := 0; i < len(str); {
+		r, w := utf8.DecodeRuneInString(str[i:])
+		i += w
+		if r == cfg.Escape && r != 0 {
+			_, w = utf8.DecodeRuneInString(str[i:])
+			i += w // The escaped rune is never the start of an expansion
+		} else if r == '$' && e.subst != nil && strings.HasPrefix(str[i:], "(") {
+			end, ok := cfg.substitutionEnd(str, i+1)
+			if !ok {
+				return "", false, errors.New("Unterminated command substitution: " + str[i-w:])
+			}
+			out, err := e.subst(str[i+1 : end-1])
+			if err != nil {
+				return "", false, err
+			}
+			buf.WriteString(cfg.unescape(str[lit : i-w]))
+			buf.WriteString(out)
+			i, lit, changed = end, end, true
+		} else if r == '$' && e.lookup != nil {
+			if name, n := parseVarName(str[i:]); n > 0 {
+				buf.WriteString(cfg.unescape(str[lit : i-w]))
+				val, _ := e.lookup(name)
+				buf.WriteString(val)
+				i += n
+				lit, changed = i, true
+			}
+		}
+	}
+	if !changed {
+		return "", false, nil
+	}
+	buf.WriteString(cfg.unescape(str[lit:]))
+	return buf.String(), true, nil
+}
+
+// Returns one token for each value, separated by whitespace tokens. They all get the span of t,
+// but only the first keeps the raw text.
+func (t *Token) expandInto(vals []string) (ret TokenSet) {
+	srcLen := t.Span().End - t.Pos
+	for idx := range vals {
+		nt := *t
+		nt.exp = &vals[idx]
+		nt.srcLen = srcLen
+		if idx > 0 {
+			nt.val = ""
+			ret = append(ret, Token{Type: TokenWhitespace, Pos: t.Pos, Col: t.Col, cfg: t.cfg, exp: &expansionSeparator, srcLen: srcLen})
+		}
+		ret = append(ret, nt)
+	}
+	return
+}
+
+// Returns the expanded tokens. Brace expansion is only done on unquoted tokens, and the others
+// only on unquoted and double quoted tokens. The raw text of the tokens is kept, so positions
+// still refer to the input. The input is not modified.
+func (e *expander) expand(ts TokenSet) (TokenSet, error) {
+	ret := ts
+	copied := false
+	for idx, t := range ts {
+		if t.Type != TokenString && t.Type != TokenDQuoted {
+			if copied {
+				ret = append(ret, t)
+			}
+			continue
+		}
+		cfg := t.config()
+
+		words := []string{t.ToString()}
+		if e.braces && t.Type == TokenString {
+			if braced := cfg.expandBraces(t.val); braced != nil {
+				words = braced
+			}
+		}
+
+		var vals []string
+		for _, w := range words {
+			val, ok, err := e.expandWord(cfg, w)
+			if err != nil {
+				return nil, err
+			} else if !ok && len(words) == 1 {
+				break // Nothing expanded, so keep the token as it is
+			} else if !ok {
+				val = cfg.unescape(w)
+			}
+			vals = append(vals, val)
+		}
+
+		var toks TokenSet
+		if len(vals) == 1 {
+			nt := t
+			nt.exp = &vals[0]
+			toks = TokenSet{nt}
+		} else if len(vals) > 1 {
+			toks = t.expandInto(vals)
+		}
+
+		if len(toks) > 0 && !copied {
+			ret = append(TokenSet{}, ts[:idx]...) // Copy on first write, so we dont modify the input
+			copied = true
+		}
+		if len(toks) > 0 {
+			ret = append(ret, toks...)
+		} else if copied {
+			ret = append(ret, t)
+		}
+	}
+	return ret, nil
+}
+
+// Returns a set where $VAR and ${VAR} are expanded in unquoted and double quoted tokens.
+// The raw text of the tokens is kept, so positions still refer to the input.
+// Undefined variables expand to empty strings.
+func (ts TokenSet) ExpandVariables(lookup VarLookupFn) TokenSet {
+	ret, _ := (&expander{lookup: lookup}).expand(ts)
+	return ret
+}
+
+// Returns a set where {a,b} and {1..5} in unquoted tokens are expanded into several tokens, separated by whitespace.
+// All generated tokens get the span of the text they came from, but only the first keeps the raw text,
+// so String still returns the input. Use IsExpanded to see which tokens came from an expansion.
+func (ts TokenSet) ExpandBraces() TokenSet {
+	ret, _ := (&expander{braces: true}).expand(ts)
+	return ret
+}
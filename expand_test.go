@@ -0,0 +1,116 @@
+// Copyright (c) 2016 Forau @ github.com. MIT License.
+
+package gocop
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestExpandSequence(t *testing.T) {
+	check := func(input, expected string) {
+		res := expandSequence(input)
+		t.Logf("Sequence '%s' -> %q", input, res)
+		assertEqual(t, expected, strings.Join(res, ","))
+	}
+
+	check("1..5", "1,2,3,4,5")
+	check("3..1", "3,2,1")
+	check("-1..1", "-1,0,1")
+	check("1..10..3", "1,4,7,10")
+	check("10..1..-4", "10,6,2")
+	check("08..11", "08,09,10,11")
+	check("-02..1", "-02,-01,000,001")
+	check("a..e", "a,b,c,d,e")
+	check("C..A", "C,B,A")
+
+	check("1..a", "")
+	check("1..5..0", "")
+	check("ab..c", "")
+	check("1..", "")
+	check("1...5", "")
+	check("1..99999", "")
+	check("0..9223372036854775807", "")
+	check("-1..9223372036854775807", "")
+	check("9223372036854775807..-9223372036854775808", "")
+	check("9223372036854775805..9223372036854775807", "9223372036854775805,9223372036854775806,9223372036854775807")
+	check("-9223372036854775806..-9223372036854775808", "-9223372036854775806,-9223372036854775807,-9223372036854775808")
+	check("0..9223372036854775807..4611686018427387904", "0,4611686018427387904")
+	check("1..5..-9223372036854775808", "")
+}
+
+func TestLexerConfig_ExpandBraces(t *testing.T) {
+	check := func(input, expected string) {
+		res := DefaultLexerConfig.expandBraces(input)
+		t.Logf("Braces '%s' -> %q", input, res)
+		assertEqual(t, expected, strings.Join(res, " "))
+	}
+
+	check("#{dev,ops,qa}", "#dev #ops #qa")
+	check("host{1..3}", "host1 host2 host3")
+	check("{a,b}{1,2}", "a1 a2 b1 b2")
+	check("x{a,b{1,2}}y", "xay xb1y xb2y")
+	check("{,pre}fix", "fix prefix")
+	check("{a}{b,c}", "{a}b {a}c")
+	check(`\{a,b}{c,d}`, `\{a,b}c \{a,b}d`)
+	check(`{a\,b,c}`, `a\,b c`)
+	check("${x,y}{1,2}", "${x,y}1 ${x,y}2")
+	check("$(echo {a,b}){1,2}", "$(echo {a,b})1 $(echo {a,b})2")
+
+	check("plain", "")
+	check("{single}", "")
+	check("{open,", "")
+	check("{}", "")
+	check(`\{a,b}`, "")
+}
+
+func TestTokenSet_ExpandBraces(t *testing.T) {
+	check := func(input, expected string, expectedTokens int) {
+		tokens := Tokenize(input)
+		expanded := tokens.ExpandBraces()
+		t.Logf("Expanded '%s' to %d tokens", input, len(expanded))
+		assertEqual(t, expected, expanded.Value())
+		assertEqual(t, input, expanded.String()) // The raw text is kept
+		assertEqual(t, tokens.Value(), Tokenize(input).Value())
+		assertEqual(t, fmt.Sprint(expectedTokens), fmt.Sprint(len(expanded.Filter(TokenNoWhitespace))))
+	}
+
+	check("/join #{dev,ops,qa}", "/join #dev #ops #qa", 4)
+	check("ping host{1..3}.local", "ping host1.local host2.local host3.local", 4)
+	check(`ping "host{1..3}" 'x{a,b}'`, "ping host{1..3} x{a,b}", 3)
+	check(`ping host\{1..3}`, "ping host{1..3}", 2)
+	check(`ping a\ {b,c}`, "ping a b a c", 3)
+
+	for _, tok := range Tokenize("ping x{a,b}").ExpandBraces() {
+		if tok.Type != TokenEOF && tok.Pos >= 5 {
+			assertEqual(t, "true", fmt.Sprint(tok.IsExpanded()))
+			assertEqual(t, "{5 11}", fmt.Sprint(tok.Span()))
+		}
+	}
+}
+
+func TestCommandParser_ExecuteBraces(t *testing.T) {
+	log := []string{}
+	cp := newTestParser(&log)
+	cp.Vars.Set("chan", "go")
+	cp.world.AddSubCommand("echo").AddArgument("words").Times(1, 99).Handler(func(rc RunContext) (interface{}, error) {
+		return rc.Get("words"), nil
+	})
+
+	res, err := cp.Execute("echo #{dev,$chan} {1..3}")
+	assertEqual(t, "<nil>", fmt.Sprint(err))
+	assertEqual(t, "#dev #go 1 2 3", fmt.Sprint(res))
+
+	res, err = cp.Execute("ok {a,b}")
+	if ia, ok := err.(*InvalidArgument); !ok {
+		t.Error("Expected InvalidArgument, but got ", res, err)
+	} else {
+		t.Log(ia)
+		assertEqual(t, "ok {a,b}\n   ^~~~~\n", ia.Marker())
+		assertEqual(t, "true", fmt.Sprint(strings.Contains(ia.Error(), "Unexpected argument: b")))
+	}
+
+	res, err = cp.Execute("ok '{a,b}'")
+	assertEqual(t, "{a,b}", fmt.Sprint(res))
+}
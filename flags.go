@@ -0,0 +1,260 @@
+// Copyright (c) 2016 Forau @ github.com. MIT License.
+
+package gocop
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// Adds a flag like --verbose or -v to a command. It can be given anywhere after the command,
+// and RunContext.Get returns "true" if it was. Short flags can be combined, like -vq.
+// Use 0 as short if the flag only has a long name.
+func (an *ArgNode) AddFlag(name string, short rune) *ArgNode {
+	return an.addFlagNode(&ArgNode{Name: name, Short: short, AcInvokerFn: flagInvokerFn, TypeFlags: FlagNode})
+}
+
+// Adds an option that takes a value, like --user=x, --user x or -u x. It can be given anywhere after the command.
+// Use 0 as short if the option only has a long name.
+func (an *ArgNode) AddOption(name string, short rune) *ArgNode {
+	return an.addFlagNode(&ArgNode{Name: name, Short: short, AcInvokerFn: getOptionInvokerFn(name), TypeFlags: FlagNode | OptionNode})
+}
+
+func (an *ArgNode) addFlagNode(n *ArgNode) *ArgNode {
+	if an.TypeFlags&CommandNode == 0 {
+		log.Panicf("Can not add flag %s to %s, since it is not a command", n.Name, an.Name)
+	}
+	for _, f := range an.Flags {
+		if f.Name == n.Name || (n.Short != 0 && f.Short == n.Short) {
+			log.Panicf("Flag %s on %s clashes with %s", n.Name, an.Name, f.Name)
+		}
+	}
+	n.parent = an
+	an.Flags = append(an.Flags, n)
+	return n
+}
+
+// Stands for a -- that ends the flags. It is kept with the flags, so the assignment still has all its tokens
+var endOfFlagsNode = &ArgNode{Name: "--", TypeFlags: FlagNode, AcInvokerFn: nopInvokerFn}
+
+func flagInvokerFn(assignment *argNodeAssignment, context RunContext) {
+	context.Put(assignment.Node.Name, "true")
+	context.PutValue(assignment.Node.Name, true)
+}
+
+func getOptionInvokerFn(name string) AcInvokerFn {
+	return func(assignment *argNodeAssignment, context RunContext) {
+		context.Put(name, assignment.value)
+	}
+}
+
+// Writes the flags of a command, like [-v|--verbose] [-u|--user=user].
+// Flags in a group are written together, like (--file=file | --url=url)
+func (an *ArgNode) flagUsage(buf *bytes.Buffer) {
+	for _, f := range an.Flags {
+		if f.isHidden() {
+			continue
+		} else if g := an.groupOf(f); g != nil {
+			if g.first(an) == f {
+				buf.WriteRune(' ')
+				buf.WriteString(g.usage(an))
+			}
+			continue
+		}
+		buf.WriteString(" [")
+		buf.WriteString(f.flagText())
+		buf.WriteRune(']')
+	}
+}
+
+// The flag as it is shown in usage, like -v|--verbose or -u|--user=user
+func (an *ArgNode) flagText() string {
+	var buf bytes.Buffer
+	if an.Short != 0 {
+		buf.WriteRune('-')
+		buf.WriteRune(an.Short)
+		buf.WriteRune('|')
+	}
+	buf.WriteString("--")
+	buf.WriteString(an.Name)
+	if an.TypeFlags&OptionNode != 0 {
+		buf.WriteRune('=')
+		buf.WriteString(an.Name)
+	}
+	if def := an.defaultUsage(); def != "" {
+		buf.WriteString("?=")
+		buf.WriteString(def)
+	}
+	return buf.String()
+}
+
+// The tokens of the assignment and its flags, in the order they were typed.
+// Flags can come after the node, or between the values of a multi argument.
+func (ass *argNodeAssignment) typedTokens() TokenSet {
+	tokens := append(TokenSet{}, ass.Tokens...)
+	for _, f := range ass.flags {
+		tokens = append(tokens, f.Tokens...)
+	}
+	sort.SliceStable(tokens, func(i, j int) bool { return tokens[i].Pos < tokens[j].Pos })
+	return tokens
+}
+
+// The text of the assignment, including its flags
+func (ass *argNodeAssignment) text() string {
+	return ass.typedTokens().String()
+}
+
+// The last token of the assignment, including its flags
+func (ass *argNodeAssignment) lastToken() *Token {
+	tokens := ass.typedTokens()
+	if len(tokens) == 0 {
+		return nil
+	}
+	return &tokens[len(tokens)-1]
+}
+
+// Finds a flag on any of the commands on the path, from the closest command and out
+func (cap *commandAssignPath) findFlag(match func(f *ArgNode) bool) *ArgNode {
+	for idx := len(*cap) - 1; idx >= 0; idx-- {
+		for _, f := range (*cap)[idx].Node.Flags {
+			if match(f) {
+				return f
+			}
+		}
+	}
+	return nil
+}
+
+// Moves flags from the start of the overflow to the flags of the leaf, so they are not assigned to arguments.
+// Only unquoted words are flags, so "-v" can still be given as an argument. So can words after --.
+func (cap *commandAssignPath) takeFlags(leaf *argNodeAssignment) {
+	for len(leaf.overflow) > 0 && leaf.overflow[0].Type == TokenString && !leaf.overflow[0].afterFlags {
+		flags, rem := cap.matchFlags(leaf.overflow)
+		if flags == nil {
+			return
+		}
+		// The flags may be shared with forks, so we never append to them in place
+		leaf.flags = append(append([]argNodeAssignment{}, leaf.flags...), flags...)
+		leaf.overflow = rem
+	}
+}
+
+// Takes the flags of the commands the node is under from the start of the input, like takeFlags does for a path.
+// Used between the values of a multi argument, so /say hello -v world gets the flag.
+func (an *ArgNode) takeFlags(in TokenSet) (flags []argNodeAssignment, remaining TokenSet) {
+	var cmds commandAssignPath
+	for n := an.parent; n != nil; n = n.parent {
+		cmds = append(commandAssignPath{{Node: n}}, cmds...)
+	}
+	leaf := argNodeAssignment{overflow: in}
+	cmds.takeFlags(&leaf)
+	return leaf.flags, leaf.overflow
+}
+
+// Returns the flags in the first word of the input, or nil if it is not flags of the path.
+// A -- ends the flags for the rest of the command, like in GNU tools, if the path has any flags to end.
+func (cap *commandAssignPath) matchFlags(in TokenSet) (flags []argNodeAssignment, remaining TokenSet) {
+	con, rem := consumeArgumentTokens(in)
+	word := con[0].Value()
+	if word == "--" && cap.findFlag(func(f *ArgNode) bool { return true }) != nil {
+		return []argNodeAssignment{{Node: endOfFlagsNode, Tokens: con}}, rem.markAfterFlags()
+	} else if !strings.HasPrefix(word, "-") || word == "-" || word == "--" {
+		return nil, nil
+	}
+
+	if strings.HasPrefix(word, "--") {
+		name, value, hasValue := word[2:], "", false
+		if eq := strings.IndexRune(name, '='); eq >= 0 {
+			name, value, hasValue = name[:eq], name[eq+1:], true
+		}
+		f := cap.findFlag(func(f *ArgNode) bool { return f.Name == name })
+		if f == nil {
+			return nil, nil
+		}
+		ass := argNodeAssignment{Node: f, Tokens: con, value: value}
+		if f.TypeFlags&OptionNode == 0 && hasValue {
+			ass.err = fmt.Errorf("Flag does not take a value: --%s", name)
+		} else if f.TypeFlags&OptionNode != 0 && !hasValue {
+			rem = optionValue(&ass, rem)
+		}
+		return []argNodeAssignment{ass}, rem
+	}
+
+	runes := []rune(word[1:])
+	for idx, r := range runes {
+		short := r
+		f := cap.findFlag(func(f *ArgNode) bool { return f.Short == short })
+		if f == nil {
+			return nil, nil // Not flags, but maybe an argument like -5
+		}
+		ass := argNodeAssignment{Node: f, Tokens: con}
+		if f.TypeFlags&OptionNode != 0 {
+			// The rest of the word is the value, like -ux, else it is the next word
+			if ass.value = string(runes[idx+1:]); ass.value == "" {
+				rem = optionValue(&ass, rem)
+			}
+			return append(flags, ass), rem
+		}
+		flags = append(flags, ass)
+	}
+	return flags, rem
+}
+
+// Returns a copy of the tokens, marked so they are never taken as flags
+func (ts TokenSet) markAfterFlags() TokenSet {
+	ret := append(TokenSet{}, ts...)
+	for idx := range ret {
+		ret[idx].afterFlags = true
+	}
+	return ret
+}
+
+// Takes the value of an option from the next word
+func optionValue(ass *argNodeAssignment, in TokenSet) (remaining TokenSet) {
+	if !in.HasText() || in[0].Type == TokenOperator {
+		ass.err = fmt.Errorf("Missing value for option: --%s", ass.Node.Name)
+		return in
+	}
+	con, rem := consumeArgumentTokens(in)
+	ass.value = con[0].Value()
+	ass.Tokens = append(append(TokenSet{}, ass.Tokens...), con...)
+	return rem
+}
+
+// Sugests the long flags of the commands on the path, if the word being typed starts with -
+func (cap *commandAssignPath) sugestFlags() (ret []string) {
+	leaf := cap.leaf()
+	typed := leaf.overflow
+	if n := len(leaf.flags); len(typed) == 0 && n > 0 && leaf.flags[n-1].Node == endOfFlagsNode {
+		typed = leaf.flags[n-1].Tokens // A -- that may still be typed, like --verbose
+	} else if len(typed) == 0 {
+		typed = leaf.Tokens
+	}
+	word := typed.Trimmed()
+	// Only while the word is typed, so not if it is followed by a whitespace
+	if len(word) != 1 || word[0].Type != TokenString || word[0].afterFlags || typed[len(typed)-1].IsWhitespace() ||
+		!strings.HasPrefix(word[0].Value(), "-") {
+		return
+	}
+
+	// Everything typed before the word, flags included
+	var prefix bytes.Buffer
+	for idx := range *cap {
+		for _, t := range (*cap)[idx].typedTokens() {
+			if t.Pos < word[0].Pos {
+				prefix.WriteString(t.val)
+			}
+		}
+	}
+	for idx := range *cap {
+		for _, f := range (*cap)[idx].Node.Flags {
+			if long := "--" + f.Name; strings.HasPrefix(long, word[0].Value()) && !f.isHidden() {
+				ret = append(ret, prefix.String()+long)
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2016 Forau @ github.com. MIT License.
+
+package gocop
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// The arguments are named after the test, since sugestions are shared between arguments with the same name
+func flagWorld(test string) *ArgNode {
+	n := NewWorldNode()
+	connect := n.AddSubCommand("/connect").Handler(func(rc RunContext) (interface{}, error) {
+		return fmt.Sprintf("server=%s nick=%s user=%s v=%s q=%s", rc.Get(test+".server"), rc.Get(test+".nick"),
+			rc.Get("user"), rc.Get("verbose"), rc.Get("quiet")), nil
+	})
+	connect.AddFlag("verbose", 'v').Description("Print more")
+	connect.AddFlag("quiet", 'q')
+	connect.AddOption("user", 'u')
+	connect.AddArgument(test + ".server").AddArgument(test + ".nick").Optional()
+	n.AddSubCommand("/calc").Handler(func(rc RunContext) (interface{}, error) {
+		return rc.Get(test + ".num"), nil
+	}).AddArgument(test + ".num")
+	return n
+}
+
+func TestArgNode_AddFlag(t *testing.T) {
+	n := flagWorld("flag")
+
+	check := func(input, expected string) {
+		res, err := n.InvokeCommand(input, &DefaultRunContext{values: make(map[string]string)})
+		if err != nil {
+			res = strings.Split(err.Error(), "\n")[0]
+		}
+		t.Logf("%q -> %v", input, res)
+		assertEqual(t, expected, fmt.Sprint(res))
+	}
+
+	check("/connect srv", "server=srv nick= user= v= q=")
+	check("/connect srv --user=bob", "server=srv nick= user=bob v= q=")
+	check("/connect --user bob srv", "server=srv nick= user=bob v= q=")
+	check("/connect srv -u bob nick", "server=srv nick=nick user=bob v= q=")
+	check("/connect srv -ubob", "server=srv nick= user=bob v= q=")
+	check("/connect -vq srv", "server=srv nick= user= v=true q=true")
+	check("/connect srv nick --verbose", "server=srv nick=nick user= v=true q=")
+	check("/connect -vu bob srv", "server=srv nick= user=bob v=true q=")
+	check(`/connect "-v" srv`, "server=-v nick=srv user= v= q=")
+	check("/connect srv -x", "server=srv nick=-x user= v= q=")
+	check("/calc -5", "-5")
+	check("/connect srv --user", "Missing value for option: --user")
+	check("/connect srv --verbose=yes", "Flag does not take a value: --verbose")
+	check("/connect srv nick -x", "Unexpected argument: -x")
+	check("/connect srv -- -v", "server=srv nick=-v user= v= q=")
+	check("/connect -v -- -q -u", "server=-q nick=-u user= v=true q=")
+	check("/connect srv -- n1", "server=srv nick=n1 user= v= q=")
+	check("/connect -- srv -- ", "server=srv nick=-- user= v= q=")
+	check("/calc --", "--") // Not the end of flags, since there are none
+}
+
+func TestArgNode_FlagsBetweenValues(t *testing.T) {
+	n := NewWorldNode()
+	say := n.AddSubCommand("/say").Handler(func(rc RunContext) (interface{}, error) {
+		return fmt.Sprintf("msg=%s v=%s to=%s", rc.Get("between.msg"), rc.Get("verbose"), rc.Get("to")), nil
+	})
+	say.AddFlag("verbose", 'v')
+	say.AddOption("to", 't')
+	say.AddArgument("between.msg").Times(1, 5)
+
+	check := func(input, expected string) {
+		res, err := n.InvokeCommand(input, &DefaultRunContext{values: make(map[string]string)})
+		if err != nil {
+			res = strings.Split(err.Error(), "\n")[0]
+		}
+		t.Logf("%q -> %v", input, res)
+		assertEqual(t, expected, fmt.Sprint(res))
+	}
+
+	check("/say hello world -v", "msg=hello world v=true to=")
+	check("/say hello -v world", "msg=hello world v=true to=")
+	check("/say hello -t bob big -v world", "msg=hello big world v=true to=bob")
+	check(`/say hello "-v" world`, "msg=hello -v world v= to=")
+	check("/say hello -x world", "msg=hello -x world v= to=")
+	check("/say hello -v world --to", "Missing value for option: --to")
+	check("/say -v hello -- -t bob", "msg=hello -t bob v=true to=")
+	check("/say hello -- world -v", "msg=hello world -v v= to=")
+
+	sugs := n.SugestAutoComplete(Tokenize("/say hello -v world --t"))
+	assertEqual(t, "/say hello -v world --to", strings.Join(sugs, ","))
+}
+
+func TestArgNode_AddFlagUsage(t *testing.T) {
+	usage := flagWorld("usage").Usage("", ": ")
+	t.Log(strings.Join(usage, "\n"))
+	assertEqual(t, " /connect [-v|--verbose] [-q|--quiet] [-u|--user=user] [usage.server] [usage.nick?]", usage[0])
+	assertEqual(t, ": --verbose: Print more", usage[1])
+}
+
+func TestArgNode_AddFlagSugestions(t *testing.T) {
+	n := flagWorld("sug")
+
+	check := func(input, expected string) {
+		sugs := n.SugestAutoComplete(Tokenize(input))
+		t.Logf("%q -> %q", input, sugs)
+		assertEqual(t, expected, strings.Join(sugs, ","))
+	}
+
+	check("/connect -", "/connect --verbose,/connect --quiet,/connect --user")
+	check("/connect srv --v", "/connect srv --verbose")
+	check("/connect -v srv nick --q", "/connect -v srv nick --quiet")
+	check("/connect -v ", "")
+	check("/connect -- -", "")
+	check("/calc -", "")
+}
+
+func TestArgNode_AddFlagClash(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("Expected a panic for flags with the same short name")
+		}
+	}()
+	cmd := NewWorldNode().AddSubCommand("/cmd")
+	cmd.AddFlag("verbose", 'v')
+	cmd.AddFlag("version", 'v')
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2016 Forau @ github.com. MIT License.
+
+package gocop
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// Lets the argument expand unquoted *, ? and [...] against the filesystem, when the command is invoked.
+// Each matching file becomes a separate value, so a pattern can only match several files on multi arguments,
+// and not more than the max of Times. A pattern that does not match any file is an error.
+// Since file names can have spaces, RunContext.GetValue gives the files of a multi argument as a []string.
+func (an *ArgNode) Glob() *ArgNode {
+	an.TypeFlags |= GlobNode
+	if an.ArgType == nil {
+		invoker := an.AcInvokerFn
+		an.AcInvokerFn = func(assignment *argNodeAssignment, context RunContext) {
+			invoker(assignment, context)
+			if assignment.Node.TypeFlags&MultiArgNode != 0 {
+				context.PutValue(assignment.Node.Name, assignment.Tokens.values())
+			}
+		}
+	}
+	return an
+}
+
+// The values of the tokens, one for each word
+func (ts TokenSet) values() (ret []string) {
+	for idx := range ts {
+		if !ts[idx].IsWhitespace() {
+			ret = append(ret, ts[idx].Value())
+		}
+	}
+	return
+}
+
+// Returns the Glob pattern for an unquoted token, and if it has any wildcards.
+// Escaped runes are taken literally. Values from variables are used as patterns, like in a shell.
+func (t *Token) globPattern() (pattern string, wild bool) {
+	if t.Type != TokenString {
+		return "", false
+	} else if t.exp != nil {
+		return *t.exp, strings.ContainsAny(*t.exp, "*?[")
+	}
+
+	cfg := t.config()
+	var buf []string
+	for i := 0; i < len(t.val); {
+		r, w := utf8.DecodeRuneInString(t.val[i:])
+		i += w
+		if r == cfg.Escape && r != 0 && i < len(t.val) {
+			r, w = utf8.DecodeRuneInString(t.val[i:])
+			i += w
+			buf = append(buf, escapeGlob(string(r)))
+		} else if strings.ContainsRune("*?[]", r) {
+			wild = wild || r != ']'
+			buf = append(buf, string(r))
+		} else {
+			buf = append(buf, escapeGlob(string(r)))
+		}
+	}
+	return strings.Join(buf, ""), wild
+}
+
+// Replaces wildcard tokens with the matching files
+func (ass *argNodeAssignment) expandGlobs() (err error) {
+	var ret TokenSet
+	for idx := range ass.Tokens {
+		t := &ass.Tokens[idx]
+		pattern, wild := t.globPattern()
+		if !wild {
+			ret = append(ret, *t)
+			continue
+		}
+
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return &InvalidArgument{msg: "Invalid pattern for " + ass.Node.Name + ": " + pattern, Span: t.Span()}
+		} else if len(matches) == 0 {
+			return &InvalidArgument{msg: "No files match: " + pattern, Span: t.Span()}
+		} else if len(matches) > 1 && ass.Node.TypeFlags&MultiArgNode == 0 {
+			return &InvalidArgument{msg: "Pattern matches several files, but " + ass.Node.Name + " takes one: " + pattern, Span: t.Span()}
+		}
+		ret = append(ret, t.expandInto(matches)...)
+		if count := uint64(len(ret.values()) + len(ass.Tokens[idx+1:].values())); count > ass.Node.maxTimes && ass.Node.maxTimes > 1 {
+			return &InvalidArgument{msg: fmt.Sprintf("Pattern matches too many files, %s takes at most %d: %s", ass.Node.Name, ass.Node.maxTimes, pattern),
+				Span: t.Span()}
+		}
+	}
+	ass.Tokens = ret
+	return
+}
+
+// Expands the wildcards for all Glob nodes on the path
+func (cap *commandAssignPath) expandGlobs() error {
+	for idx := range *cap {
+		if ass := &(*cap)[idx]; ass.Node.TypeFlags&GlobNode != 0 {
+			if err := ass.expandGlobs(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
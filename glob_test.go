@@ -0,0 +1,86 @@
+// Copyright (c) 2016 Forau @ github.com. MIT License.
+
+package gocop
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestToken_GlobPattern(t *testing.T) {
+	check := func(input, expected string, expWild bool) {
+		tok := Tokenize(input)[0]
+		pattern, wild := tok.globPattern()
+		t.Logf("Pattern for '%s' is '%s' (%v)", input, pattern, wild)
+		assertEqual(t, expected, pattern)
+		assertEqual(t, fmt.Sprint(expWild), fmt.Sprint(wild))
+	}
+
+	check("*.txt", "*.txt", true)
+	check("file?.[ch]", "file?.[ch]", true)
+	check(`\*.txt`, `\*.txt`, false)
+	check(`a\ b*`, "a b*", true)
+	check("plain]", "plain]", false)
+	check("'*.txt'", "", false)
+	check(`"*.txt"`, "", false)
+}
+
+func TestCommandParser_ExecuteGlob(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"a.txt", "b.txt", "c.log", "*.txt", "d e.md"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	log := []string{}
+	cp := newTestParser(&log)
+	cp.Vars.Set("dir", dir)
+	cp.world.AddSubCommand("/send").AddArgument("files").Times(1, 99).Glob().Handler(func(rc RunContext) (interface{}, error) {
+		return strings.Replace(rc.Get("files"), dir+string(filepath.Separator), "", -1), nil
+	})
+	cp.world.AddSubCommand("/two").AddArgument("pair").Times(1, 2).Glob().Handler(func(rc RunContext) (interface{}, error) {
+		var names []string
+		for _, file := range rc.GetValue("pair").([]string) {
+			names = append(names, "<"+filepath.Base(file)+">")
+		}
+		return strings.Join(names, ""), nil
+	})
+	cp.world.AddSubCommand("/load").AddArgument("file").Glob().Handler(func(rc RunContext) (interface{}, error) {
+		return strings.Replace(rc.Get("file"), dir+string(filepath.Separator), "", -1), nil
+	})
+
+	check := func(line, expected string) {
+		res, err := cp.Execute(line)
+		if err != nil {
+			t.Log(err)
+			res = err.(*InvalidArgument).msg
+		}
+		assertEqual(t, expected, strings.Replace(fmt.Sprint(res), dir+string(filepath.Separator), "", -1))
+	}
+
+	check("/send $dir/?.txt", "*.txt a.txt b.txt")
+	check("/send $dir/[ab].txt $dir/*.log", "a.txt b.txt c.log")
+	check(`/send $dir/\*.txt`, "*.txt")
+	check(`/send "$dir/*.txt"`, "*.txt")
+	check("/load $dir/*.log", "c.log")
+	check("/load $dir/*.txt", "Pattern matches several files, but file takes one: *.txt")
+	check("/send $dir/*.none", "No files match: *.none")
+	check("ok *.none", "*.none") // Not a glob node, so left alone
+	check("/two $dir/*.md", "<d e.md>")
+	check("/two $dir/*.md $dir/*.log", "<d e.md><c.log>")
+	check("/two $dir/[ab].txt", "<a.txt><b.txt>")
+	check("/two $dir/*.txt", "Pattern matches too many files, pair takes at most 2: *.txt")
+	check("/two $dir/*.md $dir/[ab].txt", "Pattern matches too many files, pair takes at most 2: [ab].txt")
+
+	_, err = cp.Execute("/send $dir/a.txt $dir/*.none")
+	assertEqual(t, "/send $dir/a.txt $dir/*.none\n                 ^~~~~~~~~~~\n", err.(*InvalidArgument).Marker())
+}
@@ -6,8 +6,13 @@
 package gocop
 
 import (
+	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/peterh/liner"
 )
@@ -30,10 +35,19 @@ type ResultHandlerFn func(interface{}, error)
 var DefaultResultHandler = func(in interface{}, err error) {
 	if err != nil {
 		fmt.Print("\x1b[0;31m")
+		if m, ok := err.(interface {
+			Marker() string
+		}); ok {
+			fmt.Print(m.Marker())
+		}
 		fmt.Print(err)
 	} else {
 		fmt.Print("\x1b[0;35m")
-		fmt.Printf("%+v\n", in)
+		out := DefaultRenderer(in)
+		if !strings.HasSuffix(out, "\n") {
+			out += "\n"
+		}
+		fmt.Print(out)
 	}
 }
 
@@ -41,6 +55,15 @@ type RunContext interface {
 	Put(name, value string)
 	Get(name string) string
 
+	PutDefault(name, value string) // Like Put, for a value that was not given
+	IsDefault(name string) bool    // True if the value of name is a default, and not given
+
+	PutValue(name string, value interface{})
+	GetValue(name string) interface{} // The converted value of a typed argument. nil if not typed
+
+	SetInput(in interface{})
+	Input() interface{} // The result of the previous command in a pipeline. nil if not piped
+
 	SugestionProvider() SugestionProvider
 
 	Handler(rh RunHandler)
@@ -58,16 +81,45 @@ func DefaultRunContextProvider(cp *CommandParser) RunContext {
 
 type DefaultRunContext struct {
 	values            map[string]string
+	typed             map[string]interface{}
+	defaulted         map[string]bool
+	input             interface{}
 	handler           RunHandler
 	sugestionProvider SugestionProvider
 }
 
 func (drc *DefaultRunContext) Put(name, value string) {
 	drc.values[name] = value
+	delete(drc.defaulted, name)
 }
 func (drc *DefaultRunContext) Get(name string) string {
 	return drc.values[name]
 }
+func (drc *DefaultRunContext) PutDefault(name, value string) {
+	if drc.defaulted == nil {
+		drc.defaulted = make(map[string]bool)
+	}
+	drc.values[name] = value
+	drc.defaulted[name] = true
+}
+func (drc *DefaultRunContext) IsDefault(name string) bool {
+	return drc.defaulted[name]
+}
+func (drc *DefaultRunContext) PutValue(name string, value interface{}) {
+	if drc.typed == nil {
+		drc.typed = make(map[string]interface{})
+	}
+	drc.typed[name] = value
+}
+func (drc *DefaultRunContext) GetValue(name string) interface{} {
+	return drc.typed[name]
+}
+func (drc *DefaultRunContext) SetInput(in interface{}) {
+	drc.input = in
+}
+func (drc *DefaultRunContext) Input() interface{} {
+	return drc.input
+}
 func (drc *DefaultRunContext) Handler(h RunHandler) {
 	drc.handler = h
 }
@@ -83,34 +135,71 @@ func (drc *DefaultRunContext) Invoke() (interface{}, error) {
 	}
 }
 
+// Options for how the commands are matched
+type ParserOptions uint64
+
+const (
+	IgnoreCase         ParserOptions = 1 << iota // Commands match in any case, like HELP for help
+	AbbreviateCommands                           // A unique prefix runs the command, like sh int for show interfaces
+	AllowExperimental                            // Commands, arguments and flags marked Experimental can be used
+)
+
 type CommandParser struct {
 	liner *liner.State
 
 	world *ArgNode
 
+	acTokens TokenSet // Tokens from last autocomplete, so we only need to scan the edited part
+
+	Lexer *LexerConfig // Rules for tokenizing the input
+	Vars  *Variables   // Session variables, expanded from $VAR and ${VAR}
+
+	Options ParserOptions
+
+	Prompt             string // Shown when reading a new command
+	ContinuationPrompt string // Shown when the command continues on the next line
+
 	rcProvider        RunContextProviderFn
 	SugestionProvider SugestionProvider
 	ResultHandler     ResultHandlerFn
+	Renderer          RenderFn // Renders results that are redirected to files
 }
 
 func NewCommandParser() *CommandParser {
 	return &CommandParser{
-		rcProvider:        DefaultRunContextProvider,
-		SugestionProvider: SugestionProvider{},
-		ResultHandler:     DefaultResultHandler,
+		Lexer:              DefaultLexerConfig.clone(), // Our own, so changing it does not change Tokenize
+		Vars:               NewVariables(),
+		Prompt:             "➜ ",
+		ContinuationPrompt: "… ",
+		rcProvider:         DefaultRunContextProvider,
+		SugestionProvider:  SugestionProvider{},
+		ResultHandler:      DefaultResultHandler,
+		Renderer:           DefaultRenderer,
 	}
 }
 
 func (cp *CommandParser) AutoCompleter(line string) (c []string) {
 	if cp.world != nil {
-		tokens := Tokenize(line)
-		c = append(c, cp.world.SugestAutoComplete(tokens)...)
+		if len(cp.acTokens) > 0 && cp.acTokens[0].cfg == cp.Lexer {
+			cp.acTokens = cp.acTokens.Retokenize(line)
+		} else {
+			cp.acTokens = cp.Lexer.Tokenize(line)
+		}
+		tokens := cp.acTokens
+		if tokens.Err() != nil {
+			return // Dont guess what malformed input means
+		}
+		if c = cp.completeVariable(tokens); len(c) > 0 {
+			return
+		}
+		c = append(c, cp.completeSegment(tokens)...)
 	}
 	return // TODO: Implement
 }
 
 func (cp *CommandParser) NewWorld() *ArgNode {
 	cp.world = NewWorldNode()
+	cp.world.options = &cp.Options // So changes to the options apply to the world
 
 	// Add standard commands. This might be optional later
 	cp.AddStandardCommands(cp.world)
@@ -120,20 +209,76 @@ func (cp *CommandParser) NewWorld() *ArgNode {
 
 func (cp *CommandParser) AddStandardCommands(an *ArgNode) {
 	an.AddSubCommand("help").Handler(cp.printHelp).AddArgument("help_argument").Optional()
+
+	an.AddSubCommand("set").Description("Sets a session variable").Handler(cp.setVariable).
+		AddArgument("variable").AddArgument("value").Times(0, 999)
+	an.AddSubCommand("unset").Description("Removes a session variable").Handler(cp.unsetVariable).
+		AddArgument("variable").AcSugestorFn = cp.variableSugestorFn
+	an.AddSubCommand("vars").Description("Lists the session variables").Handler(cp.listVariables)
 }
 
+// Returns the usage as the result, so it can be redirected to a file
 func (cp *CommandParser) printHelp(rc RunContext) (interface{}, error) {
-	fmt.Println("Usage:")
+	var buf bytes.Buffer
+	buf.WriteString("Usage:\n")
 	for _, u := range cp.world.Usage("\t\t", "\t\t\t") {
-		fmt.Println(u)
+		buf.WriteString(u)
+		buf.WriteRune('\n')
 	}
-	return nil, nil
+	return buf.String(), nil
 }
 
 func (cp *CommandParser) NewRunContext() RunContext {
 	return cp.rcProvider(cp)
 }
 
+// Reads one command using nextLine. If a line ends inside a quoted string, or with a backslash,
+// we keep reading lines with the continuation prompt until the command is complete.
+// A trailing backslash is removed together with the linebreak, while a linebreak inside quotes is kept.
+// After `<<EOF`, lines are read as they are, until a line with only EOF.
+func (cp *CommandParser) readCommand(nextLine func(prompt string) (string, error)) (string, error) {
+	line, err := nextLine(cp.Prompt)
+	for tokens := cp.Lexer.Tokenize(line); err == nil && tokens.NeedsContinuation(); tokens = cp.Lexer.Tokenize(line) {
+		var more string
+		if more, err = nextLine(cp.ContinuationPrompt); err != nil {
+			break
+		}
+		if tokens[len(tokens)-1].Type != TokenHeredoc && cp.Lexer.endsWithEscape(line) {
+			line = line[:len(line)-utf8.RuneLen(cp.Lexer.Escape)] + more
+		} else {
+			line += "\n" + more
+		}
+	}
+	return line, err
+}
+
+// Runs the commands read from r, and reports each result to the ResultHandler.
+// Commands can continue over several lines, and take here-documents, just like in MainLoop.
+func (cp *CommandParser) RunScript(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	nextLine := func(prompt string) (string, error) {
+		if scanner.Scan() {
+			return scanner.Text(), nil
+		} else if err := scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+
+	for {
+		l, err := cp.readCommand(nextLine)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if cp.Lexer.Tokenize(l).HasText() {
+			cp.ResultHandler(cp.Execute(l)) // An unfinished command at the end is reported as an error
+		}
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
 func (cp *CommandParser) MainLoop() (err error) {
 	defer func() {
 		switch x := recover().(type) {
@@ -153,13 +298,15 @@ func (cp *CommandParser) MainLoop() (err error) {
 
 	for {
 		fmt.Print("\x1b[0;33m")
-		l, err := cp.liner.Prompt("➜ ")
-		if err != nil {
+		l, err := cp.readCommand(cp.liner.Prompt)
+		if err == liner.ErrPromptAborted && l != "" {
+			continue // Aborted during continuation, so just drop the unfinished command
+		} else if err != nil {
 			panic(err)
 		}
 		cp.liner.AppendHistory(l)
 		fmt.Printf("\x1b[0;36m")
-		res, err := cp.world.InvokeCommand(l, cp.NewRunContext())
+		res, err := cp.Execute(l)
 		cp.ResultHandler(res, err)
 		fmt.Print("\x1b[0m")
 	}
@@ -1,12 +1,12 @@
 package gocop
 
 import (
+	"errors"
 	"log"
+	"strings"
 	"testing"
 )
 
-var _ testing.T
-
 func ExampleCommandParser_NewWorld() {
 	cp := NewCommandParser()
 
@@ -22,3 +22,79 @@ func ExampleCommandParser_NewWorld() {
 		log.Print(u)
 	}
 }
+
+func TestCommandParser_readCommandContinuation(t *testing.T) {
+	cp := NewCommandParser()
+	read := func(lines ...string) string {
+		prompts := []string{}
+		res, err := cp.readCommand(func(prompt string) (string, error) {
+			prompts = append(prompts, prompt)
+			if len(lines) == 0 {
+				return "", errors.New("Out of lines")
+			}
+			l := lines[0]
+			lines = lines[1:]
+			return l, nil
+		})
+		if err != nil {
+			t.Error("Did not expect error: ", err)
+		}
+		if len(lines) > 0 {
+			t.Error("Expected all lines to be read, but got left: ", lines)
+		}
+		for i, p := range prompts {
+			if (i == 0) != (p == cp.Prompt) {
+				t.Errorf("Expected prompt for line %d to be the continuation prompt, but got '%s'", i, p)
+			}
+		}
+		return res
+	}
+
+	assertEqual(t, "/msg bob hello", read("/msg bob hello"))
+	assertEqual(t, "/msg bob \"first\nsecond\nthird\"", read("/msg bob \"first", "second", "third\""))
+	assertEqual(t, "/msg bob 'it\nis'", read("/msg bob 'it", "is'"))
+	assertEqual(t, "/msg bob hello world", read("/msg bob hello \\", "world"))
+	assertEqual(t, "/msg bob \"a\nb c\"", read("/msg bob \"a", "b \\", "c\""))
+	assertEqual(t, "/msg bob <<EOF\nit's \\\n\nEOF", read("/msg bob <<EOF", "it's \\", "", "EOF"))
+}
+
+func TestCommandParser_RunScript(t *testing.T) {
+	log := []string{}
+	cp := newTestParser(&log)
+	script := "ok first\n" +
+		"\n" +
+		"ok <<END\n" +
+		"some 'lines\n" +
+		"  $kept as is\n" +
+		"END\n" +
+		"fail \\\n" +
+		"  last\n" +
+		"ok <<END\n" +
+		"unterminated"
+	if err := cp.RunScript(strings.NewReader(script)); err != nil {
+		t.Error("Did not expect error: ", err)
+	}
+	for _, l := range log {
+		t.Log(l)
+	}
+	assertEqual(t, "ok first", log[0])
+	assertEqual(t, "result(first, <nil>)", log[1])
+	assertEqual(t, "ok some 'lines\n  $kept as is", log[2])
+	assertEqual(t, "fail last", log[4])
+	if len(log) != 7 || !strings.Contains(log[6], "Unterminated here-document, missing: END") {
+		t.Error("Expected the unterminated here-document to be reported, but got ", log)
+	}
+}
+
+func TestNewCommandParser_OwnLexer(t *testing.T) {
+	cp := NewCommandParser()
+	cp.Lexer.Escape = 0
+	cp.Lexer.Comment = '#'
+	cp.Lexer.Operators[0] = "&"
+
+	other := NewCommandParser()
+	assertEqual(t, `\ ;`, string(other.Lexer.Escape)+" "+other.Lexer.Operators[0])
+	assertEqual(t, `a\ b # c`, Tokenize(`a\ b # c`).String())
+	assertEqual(t, "a b", Tokenize(`a\ b`).Value()) // Still escaped by the default config
+	assertEqual(t, `a\ b`, Quote("a b"))
+}
@@ -0,0 +1,192 @@
+// Copyright (c) 2016 Forau @ github.com. MIT License.
+
+package gocop
+
+import (
+	"log"
+	"strings"
+)
+
+// How the members of a group depend on each other
+type GroupKind int
+
+const (
+	OneOfGroup     GroupKind = iota // Exactly one of the members must be given
+	AllOrNoneGroup                  // The members must be given together, or not at all
+)
+
+// Flags, options or optional arguments of a command that depend on each other
+type ArgGroup struct {
+	Kind  GroupKind
+	Names []string
+}
+
+// Makes exactly one of the flags or options required, like --file or --url. Shown in usage as (a | b).
+// The members can also be optional arguments after the command. Returns the command, so more can be added to it.
+func (an *ArgNode) OneOf(names ...string) *ArgNode {
+	return an.addGroup(OneOfGroup, names)
+}
+
+// Makes the flags or options required together, like --user and --password, or not at all.
+// The members can also be optional arguments after the command, like [user password] in usage.
+// Returns the command, so more can be added to it.
+func (an *ArgNode) AllOrNone(names ...string) *ArgNode {
+	return an.addGroup(AllOrNoneGroup, names)
+}
+
+func (an *ArgNode) addGroup(kind GroupKind, names []string) *ArgNode {
+	if an.TypeFlags&CommandNode == 0 {
+		log.Panicf("Can not add group to %s, since it is not a command", an.Name)
+	} else if len(names) < 2 {
+		log.Panicf("A group on %s needs atleast two members, but got %v", an.Name, names)
+	}
+	for _, name := range names {
+		if m := an.member(name); m == nil {
+			log.Panicf("Group on %s has %s, which is not a flag or argument of it", an.Name, name)
+		} else if an.groupOf(m) != nil {
+			log.Panicf("%s on %s is already in a group", name, an.Name)
+		} else if m.TypeFlags&FlagNode != an.member(names[0]).TypeFlags&FlagNode {
+			log.Panicf("Group on %s mixes flags and arguments: %v", an.Name, names)
+		} else if m.TypeFlags&(FlagNode|OptionalNode) == 0 {
+			log.Panicf("Argument %s on %s must be optional to be in a group", name, an.Name)
+		}
+	}
+	an.Groups = append(an.Groups, &ArgGroup{Kind: kind, Names: names})
+	return an
+}
+
+// Finds the flag of the command by name, or nil
+func (an *ArgNode) flag(name string) *ArgNode {
+	for _, f := range an.Flags {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// Finds the argument after the command by name, or nil. Arguments of sub commands are not included
+func (an *ArgNode) argument(name string) *ArgNode {
+	for _, c := range an.Children {
+		if c.TypeFlags&CommandNode != 0 {
+			continue
+		} else if c.Name == name {
+			return c
+		} else if a := c.argument(name); a != nil {
+			return a
+		}
+	}
+	return nil
+}
+
+// Finds the flag or argument of the command by name, or nil. Flags go first
+func (an *ArgNode) member(name string) *ArgNode {
+	if f := an.flag(name); f != nil {
+		return f
+	}
+	return an.argument(name)
+}
+
+// Returns the group the flag or argument of the command is in, or nil
+func (an *ArgNode) groupOf(m *ArgNode) *ArgGroup {
+	for _, g := range an.Groups {
+		for _, name := range g.Names {
+			if an.member(name) == m {
+				return g
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the group of an argument, and the command it is on, or nil if it is not in one
+func (an *ArgNode) argumentGroup() (*ArgGroup, *ArgNode) {
+	if an.TypeFlags&ArgumentNode == 0 {
+		return nil, nil
+	}
+	for cmd := an.parent; cmd != nil; cmd = cmd.parent {
+		if cmd.TypeFlags&CommandNode != 0 {
+			return cmd.groupOf(an), cmd
+		}
+	}
+	return nil, nil
+}
+
+// The visible members of the group, in the order of the group
+func (g *ArgGroup) members(cmd *ArgNode) (ret []*ArgNode) {
+	for _, name := range g.Names {
+		if m := cmd.member(name); !m.isHidden() {
+			ret = append(ret, m)
+		}
+	}
+	return
+}
+
+// The first member of the group in usage
+func (g *ArgGroup) first(cmd *ArgNode) *ArgNode {
+	if members := g.members(cmd); len(members) > 0 {
+		return members[0]
+	}
+	return nil
+}
+
+// Renders the group like (--file=file | --url=url) or [user password]
+func (g *ArgGroup) usage(cmd *ArgNode) string {
+	var texts []string
+	for _, m := range g.members(cmd) {
+		if m.TypeFlags&FlagNode != 0 {
+			texts = append(texts, m.flagText())
+		} else {
+			texts = append(texts, m.Name)
+		}
+	}
+	if g.Kind == OneOfGroup {
+		return "(" + strings.Join(texts, " | ") + ")"
+	}
+	return "[" + strings.Join(texts, " ") + "]"
+}
+
+// The names of the group as they are typed, like --file, --url
+func (g *ArgGroup) typedNames(cmd *ArgNode) string {
+	var names []string
+	for _, name := range g.Names {
+		names = append(names, cmd.member(name).typedName())
+	}
+	return strings.Join(names, ", ")
+}
+
+// Checks that the groups of the commands on the path got the members they need.
+// Defaults do not count, since they are applied later, and only when a member is not given.
+func (cap *commandAssignPath) checkGroups() (err error) {
+	given := make(map[*ArgNode]*argNodeAssignment)
+	end := 0
+	cap.eachAssignment(func(ass *argNodeAssignment) {
+		if given[ass.Node] == nil {
+			given[ass.Node] = ass
+		}
+		if sp := ass.Tokens.Span(); sp.End > end {
+			end = sp.End
+		}
+	})
+
+	for _, ass := range *cap {
+		for _, g := range ass.Node.Groups {
+			var got []*argNodeAssignment
+			for _, name := range g.Names {
+				if a := given[ass.Node.member(name)]; a != nil {
+					got = append(got, a)
+				}
+			}
+			switch {
+			case g.Kind == OneOfGroup && len(got) == 0:
+				return &InvalidArgument{msg: "Missing one of: " + g.typedNames(ass.Node), Span: Span{end, end}}
+			case g.Kind == OneOfGroup && len(got) > 1:
+				return &InvalidArgument{msg: "Only one of " + g.typedNames(ass.Node) + " can be given, but got " +
+					got[0].Node.typedName() + " and " + got[1].Node.typedName(), Span: got[1].Tokens.Span()}
+			case g.Kind == AllOrNoneGroup && len(got) > 0 && len(got) < len(g.Names):
+				return &InvalidArgument{msg: "Give all or none of: " + g.typedNames(ass.Node), Span: got[0].Tokens.Span()}
+			}
+		}
+	}
+	return nil
+}
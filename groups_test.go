@@ -0,0 +1,78 @@
+// Copyright (c) 2016 Forau @ github.com. MIT License.
+
+package gocop
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func groupWorld() *ArgNode {
+	n := NewWorldNode()
+	fetch := n.AddSubCommand("/fetch").Handler(func(rc RunContext) (interface{}, error) {
+		return fmt.Sprintf("file=%s url=%s user=%s password=%s", rc.Get("file"), rc.Get("url"), rc.Get("user"), rc.Get("password")), nil
+	})
+	fetch.AddFlag("verbose", 'v')
+	fetch.AddOption("file", 'f')
+	fetch.AddOption("url", 0)
+	fetch.AddOption("user", 'u')
+	fetch.AddOption("password", 'p')
+	fetch.OneOf("file", "url").AllOrNone("user", "password")
+	login := n.AddSubCommand("/login").Handler(func(rc RunContext) (interface{}, error) {
+		return fmt.Sprintf("host=%s user=%s password=%s", rc.Get("group.host"), rc.Get("group.user"), rc.Get("group.password")), nil
+	})
+	login.AddArgument("group.host").AddArgument("group.user").Optional().AddArgument("group.password").Optional()
+	login.AllOrNone("group.user", "group.password")
+	return n
+}
+
+func TestArgNode_Groups(t *testing.T) {
+	n := groupWorld()
+
+	check := func(input, expected, marker string) {
+		res, err := n.InvokeCommand(input, &DefaultRunContext{values: make(map[string]string)})
+		if ia, ok := err.(*InvalidArgument); ok {
+			res = strings.Split(err.Error(), "\n")[0]
+			assertEqual(t, marker, ia.Marker())
+		}
+		t.Logf("%q -> %v", input, res)
+		assertEqual(t, expected, fmt.Sprint(res))
+	}
+
+	check("/fetch -f a", "file=a url= user= password=", "")
+	check("/fetch --url=b -u bob -p secret", "file= url=b user=bob password=secret", "")
+	check("/fetch -v", "Missing one of: --file, --url", "/fetch -v\n         ^\n")
+	check("/fetch -f a --url b", "Only one of --file, --url can be given, but got --file and --url",
+		"/fetch -f a --url b\n            ^~~~~~~\n")
+	check("/fetch -f a -p secret", "Give all or none of: --user, --password", "/fetch -f a -p secret\n            ^~~~~~~~~\n")
+
+	check("/login srv", "host=srv user= password=", "")
+	check("/login srv bob secret", "host=srv user=bob password=secret", "")
+	check("/login srv bob", "Give all or none of: group.user, group.password", "/login srv bob\n           ^~~\n")
+
+	usage := n.Usage("", "")
+	t.Log(strings.Join(usage, "\n"))
+	assertEqual(t, " /fetch [-v|--verbose] (-f|--file=file | --url=url) [-u|--user=user -p|--password=password]", usage[0])
+	assertEqual(t, " /login [group.host] [group.user group.password]", usage[1])
+}
+
+func TestArgNode_GroupPanics(t *testing.T) {
+	check := func(descr string, fn func(cmd *ArgNode)) {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Error("Expected a panic for", descr)
+			}
+		}()
+		cmd := NewWorldNode().AddSubCommand("/cmd")
+		cmd.AddFlag("a", 0)
+		cmd.AddFlag("b", 0)
+		fn(cmd)
+	}
+
+	check("an unknown flag", func(cmd *ArgNode) { cmd.OneOf("a", "c") })
+	check("a single flag", func(cmd *ArgNode) { cmd.OneOf("a") })
+	check("a flag in two groups", func(cmd *ArgNode) { cmd.OneOf("a", "b").AllOrNone("a", "b") })
+	check("a mandatory argument", func(cmd *ArgNode) { cmd.AddArgument("c").AddArgument("d").Optional(); cmd.OneOf("c", "d") })
+	check("flags and arguments", func(cmd *ArgNode) { cmd.AddArgument("c").Optional(); cmd.OneOf("a", "c") })
+}
@@ -0,0 +1,45 @@
+// Copyright (c) 2016 Forau @ github.com. MIT License.
+
+package gocop
+
+// Moves the here-documents to where they were started, so `cmd arg <<EOF` gets the lines as the last argument.
+// The << and the terminator are removed.
+func bindHeredocs(line string, ts TokenSet) (TokenSet, error) {
+	var slots []int   // Where the here-documents go in ret
+	var starts []Span // The << and terminator for each slot
+	var terms []string
+	var bodies TokenSet
+
+	ret := make(TokenSet, 0, len(ts))
+	for idx := 0; idx < len(ts); idx++ {
+		t := ts[idx]
+		if t.Type == TokenHeredoc {
+			bodies = append(bodies, t)
+			continue
+		} else if t.Type != TokenOperator || t.val != heredocOperator {
+			ret = append(ret, t)
+			continue
+		}
+
+		term := idx + 1
+		for term < len(ts) && ts[term].Type == TokenWhitespace {
+			term++
+		}
+		if term == len(ts) || ts[term].Type&TokenNoWhitespace == 0 || ts[term].Type == TokenHeredoc {
+			return nil, &InvalidArgument{msg: "Missing terminator after: " + t.val, input: line, Span: t.Span()}
+		}
+		slots = append(slots, len(ret))
+		starts = append(starts, Span{t.Pos, ts[term].Span().End})
+		terms = append(terms, ts[term].Value())
+		ret = append(ret, t) // Replaced by the here-document below
+		idx = term
+	}
+
+	for idx, slot := range slots {
+		if idx >= len(bodies) || bodies[idx].incomplete {
+			return nil, &InvalidArgument{msg: "Unterminated here-document, missing: " + terms[idx], input: line, Span: starts[idx]}
+		}
+		ret[slot] = bodies[idx]
+	}
+	return ret, nil
+}
@@ -0,0 +1,55 @@
+// Copyright (c) 2016 Forau @ github.com. MIT License.
+
+package gocop
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestTokenize_Heredoc(t *testing.T) {
+	check := func(input string, expected ...string) {
+		var res []string
+		for _, tok := range Tokenize(input).Filter(TokenHeredoc) {
+			res = append(res, fmt.Sprintf("%q(%v)", tok.Value(), tok.incomplete))
+		}
+		t.Logf("Here-documents in %q: %v", input, res)
+		assertEqual(t, fmt.Sprint(expected), fmt.Sprint(res))
+		assertEqual(t, input, Tokenize(input).String())
+	}
+
+	check("cmd <<EOF\nline 1\n  'line 2\nEOF", `"line 1\n  'line 2"(false)`)
+	check("cmd <<EOF; ok\nline\nEOF\nafter", `"line"(false)`)
+	check("cmd <<'A B' <<C\n1\nA B\n2\nC", `"1"(false)`, `"2"(false)`)
+	check("cmd <<EOF\nEOF", `""(false)`)
+	check("cmd <<EOF\r\nline\r\nEOF\r\n", "\"line\\r\"(false)")
+	check("cmd <<EOF\nline\n EOF", "\"line\\n EOF\"(true)")
+	check("cmd <<EOF", `""(true)`)
+	check("cmd '<<EOF'\nline", []string(nil)...)
+}
+
+func TestCommandParser_ExecuteHeredoc(t *testing.T) {
+	log := []string{}
+	cp := newTestParser(&log)
+	cp.world.AddSubCommand("echo").AddArgument("words").Times(1, 99).Handler(func(rc RunContext) (interface{}, error) {
+		return rc.Get("words"), nil
+	})
+
+	check := func(line, expected string) {
+		res, err := cp.Execute(line)
+		if err != nil {
+			t.Log(err)
+			res = err.(*InvalidArgument).msg
+		}
+		assertEqual(t, expected, fmt.Sprint(res))
+	}
+
+	check("echo first <<EOF\nline 1\n$line 2\nEOF", "first line 1\n$line 2")
+	check("ok <<A && echo <<B\none\nA\ntwo\nB", "two")
+	check("ok <<EOF; ok x", "Unterminated here-document, missing: EOF")
+	check("ok <<", "Missing terminator after: <<")
+	check("ok a <<EOF\nb\nEOF", "Unexpected argument: b")
+
+	_, err := cp.Execute("ok <<EOF\nb")
+	assertEqual(t, "ok <<EOF\n   ^~~~~\n", err.(*InvalidArgument).Marker())
+}
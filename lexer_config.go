@@ -0,0 +1,185 @@
+// Copyright (c) 2016 Forau @ github.com. MIT License.
+
+package gocop
+
+import (
+	"unicode"
+	"unicode/utf8"
+
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+// A pair of quotes. Open and Close can be the same rune, or differ like « and ».
+// Type should be TokenDQuoted or TokenSQuoted.
+type QuotePair struct {
+	Open, Close rune
+	Type        TokenType
+}
+
+// Rules for the lexer
+type LexerConfig struct {
+	Quotes     []QuotePair
+	Escape     rune     // Escapes the next rune. Set to 0 to disable, for example for windows paths.
+	Separators []rune   // Separates arguments, just like whitespaces
+	Comment    rune     // Comments out the rest of the line, if found where an argument could start. 0 to disable.
+	Operators  []string // Unquoted operators, like ; and &&. They are scanned as separate tokens, even without whitespace.
+
+	// If true, Value will also decode C-style escapes, like \n, \t, \xNN and \uNNNN.
+	// Otherwise only escaped quotes, escapes, separators and whitespaces are decoded.
+	// Only used when Escape is a backslash.
+	CStyleEscapes bool
+}
+
+// The config used by Tokenize
+var DefaultLexerConfig = LexerConfig{
+	Quotes: []QuotePair{
+		{'"', '"', TokenDQuoted},
+		{'\'', '\'', TokenSQuoted},
+	},
+	Escape:    '\\',
+	Operators: []string{";", "&&", "||", "|", ">", ">>", heredocOperator},
+}
+
+// Returns a copy, that can be changed without changing cfg
+func (cfg *LexerConfig) clone() *LexerConfig {
+	c := *cfg
+	c.Quotes = append([]QuotePair{}, cfg.Quotes...)
+	c.Separators = append([]rune{}, cfg.Separators...)
+	c.Operators = append([]string{}, cfg.Operators...)
+	return &c
+}
+
+// Starts a here-document, if it is one of the Operators
+const heredocOperator = "<<"
+
+// Tokenize with DefaultLexerConfig
+func Tokenize(input string) TokenSet {
+	return DefaultLexerConfig.Tokenize(input)
+}
+
+func (cfg *LexerConfig) Tokenize(input string) TokenSet {
+	return cfg.newScanner(input, 0, 0, make(TokenSet, 0, 8)).run()
+}
+
+func (cfg *LexerConfig) newScanner(input string, pos, col int, tokens TokenSet) *scanner {
+	s := &scanner{
+		input:     input,
+		cfg:       cfg,
+		state:     scanStart,
+		start:     pos,
+		pos:       pos,
+		col:       col,
+		tokens:    tokens,
+		sepFn:     cfg.isSeparator,
+		untilLine: untilRuneAcceptFn('\n'),
+		heredocSepFn: func(r rune) bool {
+			return r != '\n' && cfg.isSeparator(r)
+		},
+	}
+	// Words end at separators and operators
+	s.wordFn = func(r rune) bool {
+		return !cfg.isSeparator(r) && (len(cfg.Operators) == 0 || s.operatorAt(s.prev) == "")
+	}
+	return s
+}
+
+func (cfg *LexerConfig) maxOperatorLen() (max int) {
+	for _, op := range cfg.Operators {
+		if len(op) > max {
+			max = len(op)
+		}
+	}
+	return
+}
+
+func (cfg *LexerConfig) isSeparator(r rune) bool {
+	if unicode.IsSpace(r) {
+		return true
+	}
+	for _, sep := range cfg.Separators {
+		if sep == r {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the quote pair that opens with r, or nil
+func (cfg *LexerConfig) quoteOpenedBy(r rune) *QuotePair {
+	for idx := range cfg.Quotes {
+		if cfg.Quotes[idx].Open == r {
+			return &cfg.Quotes[idx]
+		}
+	}
+	return nil
+}
+
+// Checks if r has a special meaning to the lexer, or to variable and brace expansion, and so will be taken literally when escaped
+func (cfg *LexerConfig) isSpecial(r rune) bool {
+	if r == cfg.Escape || r == '$' || r == '{' || r == '}' || r == ',' || (r == cfg.Comment && r != 0) || cfg.isSeparator(r) {
+		return true
+	}
+	for _, q := range cfg.Quotes {
+		if q.Open == r || q.Close == r {
+			return true
+		}
+	}
+	for _, op := range cfg.Operators {
+		if first, _ := utf8.DecodeRuneInString(op); first == r {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if the string ends with an odd number of escape runes
+func (cfg *LexerConfig) endsWithEscape(str string) bool {
+	if cfg.Escape == 0 {
+		return false
+	}
+	cnt := 0
+	for len(str) > 0 {
+		r, w := utf8.DecodeLastRuneInString(str)
+		if r != cfg.Escape {
+			break
+		}
+		str = str[:len(str)-w]
+		cnt++
+	}
+	return cnt%2 == 1
+}
+
+// Resolves escapes. Unknown escapes are kept as they are, escape rune included.
+func (cfg *LexerConfig) unescape(str string) string {
+	if cfg.Escape == 0 || strings.IndexRune(str, cfg.Escape) < 0 {
+		return str // Nothing to do, so skip the allocations
+	}
+	escW := utf8.RuneLen(cfg.Escape)
+	var buf bytes.Buffer
+	for i := 0; i < len(str); {
+		r, w := utf8.DecodeRuneInString(str[i:])
+		if r != cfg.Escape || i+w == len(str) {
+			buf.WriteString(str[i : i+w])
+			i += w
+			continue
+		}
+		next, nw := utf8.DecodeRuneInString(str[i+escW:])
+		if cfg.isSpecial(next) {
+			buf.WriteString(str[i+escW : i+escW+nw])
+			i += escW + nw
+		} else if val, multibyte, tail, err := strconv.UnquoteChar(str[i:], 0); cfg.CStyleEscapes && cfg.Escape == '\\' && err == nil {
+			if multibyte {
+				buf.WriteRune(val)
+			} else {
+				buf.WriteByte(byte(val))
+			}
+			i = len(str) - len(tail)
+		} else {
+			buf.WriteString(str[i : i+escW])
+			i += escW
+		}
+	}
+	return buf.String()
+}
@@ -6,14 +6,92 @@ import (
 	"unicode"
 	"unicode/utf8"
 
+	"bytes"
+	"fmt"
 	"strings"
 )
 
 // Scanned token
 type Token struct {
 	Type       TokenType // Type
+	Pos        int       // Byte offset in the input
+	Col        int       // Rune column, counted from the start of the line
 	val        string    // Value
 	incomplete bool      // If it got terminated by eol
+
+	cfg    *LexerConfig  // The rules it was scanned with
+	exp    *string       // The decoded value, if it has been expanded. IE, from variables
+	srcLen int           // If generated by brace or glob expansion, the length of the text it came from
+	lexErr *LexicalError // Why the token is a TokenError
+
+	afterFlags bool // If it came after --, so it is never a flag
+}
+
+// Malformed input, like invalid UTF-8 or control characters
+type LexicalError struct {
+	Reason string
+	Span   Span // The offending part of the input
+
+	input  string
+	offset int // Where input starts, if it is only a part of the line
+}
+
+func (le *LexicalError) Error() string {
+	return "Malformed input: " + le.Reason + "\n"
+}
+
+// Returns the input with a ^~~~ marker under the offending part
+func (le *LexicalError) Marker() string {
+	if le.input == "" {
+		return ""
+	}
+	return Span{le.Span.Start - le.offset, le.Span.End - le.offset}.Marker(le.input)
+}
+
+// A part of the input. Start and End are byte offsets, where End is exclusive.
+type Span struct {
+	Start, End int
+}
+
+// Returns the span of the raw text
+// Tokens generated by brace expansion all get the span of the text they came from.
+func (t *Token) Span() Span {
+	if t.srcLen > 0 {
+		return Span{t.Pos, t.Pos + t.srcLen}
+	}
+	return Span{t.Pos, t.Pos + len(t.val)}
+}
+
+// Renders the line of input containing the span, with a ^~~~ marker under the span.
+func (sp Span) Marker(input string) string {
+	if sp.Start > len(input) || sp.End < sp.Start {
+		return ""
+	}
+	lineStart := strings.LastIndexByte(input[:sp.Start], '\n') + 1
+	lineEnd := len(input)
+	if idx := strings.IndexByte(input[sp.Start:], '\n'); idx >= 0 {
+		lineEnd = sp.Start + idx
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(input[lineStart:lineEnd])
+	buf.WriteRune('\n')
+	for _, r := range input[lineStart:sp.Start] {
+		if r == '\t' {
+			buf.WriteRune('\t') // Keep tabs, so the marker lines up
+		} else {
+			buf.WriteRune(' ')
+		}
+	}
+	buf.WriteRune('^')
+	if sp.End > lineEnd {
+		sp.End = lineEnd
+	}
+	if sp.End > sp.Start {
+		buf.WriteString(strings.Repeat("~", utf8.RuneCountInString(input[sp.Start:sp.End])-1))
+	}
+	buf.WriteRune('\n')
+	return buf.String()
 }
 
 // Returns the string-value. If it is a quoted string, then omit the quotes
@@ -22,14 +100,51 @@ func (t *Token) ToString() string {
 	end := len(t.val)
 	switch t.Type {
 	case TokenDQuoted, TokenSQuoted:
-		start = 1
+		open, w := utf8.DecodeRuneInString(t.val)
+		start = w
+		if q := t.config().quoteOpenedBy(open); q != nil && !t.incomplete {
+			end -= utf8.RuneLen(q.Close)
+		}
+	case TokenHeredoc:
 		if !t.incomplete {
-			end -= 1
+			end = strings.LastIndexByte(t.val, '\n') // Skip the terminator line
+			if end < 0 {
+				end = 0
+			}
 		}
 	}
 	return t.val[start:end]
 }
 
+// Returns the decoded value. Quotes are omitted, and escape sequences are resolved.
+func (t *Token) Value() string {
+	if t.Type == TokenHeredoc {
+		return t.ToString() // Taken verbatim
+	}
+	if t.exp != nil {
+		return *t.exp
+	}
+	return t.config().unescape(t.ToString())
+}
+
+// Checks if the value came from an expansion, like variables, command substitution or braces
+func (t *Token) IsExpanded() bool {
+	return t.exp != nil
+}
+
+// Returns the raw text, exactly as it was typed.
+// When brace expansion generates several tokens, only the first one keeps the raw text.
+func (t *Token) Raw() string {
+	return t.val
+}
+
+func (t *Token) config() *LexerConfig {
+	if t.cfg == nil {
+		return &DefaultLexerConfig
+	}
+	return t.cfg
+}
+
 func (t *Token) IsWhitespace() bool {
 	return t.Type&TokenAllWhitespace != 0
 }
@@ -46,9 +161,12 @@ const (
 	TokenDQuoted
 	TokenSQuoted
 	TokenWhitespace
+	TokenComment
+	TokenOperator
+	TokenHeredoc // The lines of a here-document, including the terminator line
 
-	TokenNoWhitespace  = TokenString | TokenDQuoted | TokenSQuoted
-	TokenAllWhitespace = TokenEOF | TokenWhitespace
+	TokenNoWhitespace  = TokenString | TokenDQuoted | TokenSQuoted | TokenHeredoc
+	TokenAllWhitespace = TokenEOF | TokenWhitespace | TokenComment
 )
 
 type TokenSet []Token
@@ -66,6 +184,35 @@ func (ts TokenSet) Stringify() string {
 	return ts.Trimmed().String()
 }
 
+// Returns the decoded value, striped of head and trail whitespaces.
+// Whitespaces between the tokens are kept as they are.
+func (ts TokenSet) Value() string {
+	var buf bytes.Buffer
+	for _, t := range ts.Trimmed() {
+		if t.IsWhitespace() && t.exp != nil {
+			buf.WriteString(*t.exp) // Separates tokens from brace or glob expansion
+		} else if t.IsWhitespace() {
+			buf.WriteString(t.val)
+		} else {
+			buf.WriteString(t.Value())
+		}
+	}
+	return buf.String()
+}
+
+// Returns the span of the trimmed set. If there is no text, we get an empty span at the end.
+func (ts TokenSet) Span() Span {
+	trimmed := ts.Trimmed()
+	if len(trimmed) == 0 {
+		if len(ts) == 0 {
+			return Span{}
+		}
+		end := ts[len(ts)-1].Span().End
+		return Span{end, end}
+	}
+	return Span{trimmed[0].Pos, trimmed[len(trimmed)-1].Span().End}
+}
+
 // Returns a slice without leading or trailing whitespaces
 func (ts TokenSet) Trimmed() TokenSet {
 	foundNoneWS := false
@@ -104,6 +251,55 @@ func (ts TokenSet) HasText() bool {
 	return false
 }
 
+// Checks if the input ended inside a quoted string, with an escaping backslash, or with an operator like &&.
+// IE, if the command continues on the next line.
+func (ts TokenSet) NeedsContinuation() bool {
+	if len(ts) == 0 {
+		return false
+	}
+	if trimmed := ts.Trimmed(); len(trimmed) > 0 {
+		if op := trimmed[len(trimmed)-1]; op.Type == TokenOperator && op.val != ";" {
+			return true // Only ; can end a line
+		}
+	}
+	last := ts[len(ts)-1]
+	return last.incomplete || (last.Type != TokenComment && last.config().endsWithEscape(last.val))
+}
+
+// Returns the raw text, striped of head and trail whitespaces, like String, but with
+// the lines of here-documents where they were bound.
+func (ts TokenSet) rest() string {
+	var buf bytes.Buffer
+	for _, t := range ts.Trimmed() {
+		if t.Type == TokenHeredoc {
+			buf.WriteString(t.Value())
+		} else {
+			buf.WriteString(t.val)
+		}
+	}
+	return buf.String()
+}
+
+// Returns the config of the first token, or DefaultLexerConfig if the set is empty
+func (ts TokenSet) config() *LexerConfig {
+	if len(ts) == 0 {
+		return &DefaultLexerConfig
+	}
+	return ts[0].config()
+}
+
+// Returns a *LexicalError for the first TokenError in the set, or nil if there is none
+func (ts TokenSet) Err() error {
+	for idx := range ts {
+		if e := ts[idx].lexErr; e != nil {
+			ret := *e
+			ret.input, ret.offset = ts.String(), ts[0].Pos
+			return &ret
+		}
+	}
+	return nil
+}
+
 func (ts TokenSet) StartsWithIgnoreCase(cmp string) bool {
 	lval := strings.ToLower(ts.Trimmed().String())
 	return strings.Index(lval, strings.ToLower(cmp)) == 0
@@ -121,13 +317,33 @@ type acceptFn func(r rune) bool
 // Also, a small lex'er is more fun.
 type scanner struct {
 	input string
+	cfg   *LexerConfig
 
 	state stateFn // Current state
 
 	start int
 	pos   int
+	prev  int // Position of the last rune from next
+
+	unterminated bool     // If a command substitution in the current token reached eof
+	col          int      // Rune column of start
+	heredocNext  bool     // If the next word is the terminator of a here-document
+	heredocs     []string // Terminators of the here-documents that start on the next line
+
+	tokens TokenSet // Where to emit the result
+
+	sepFn, wordFn, untilLine acceptFn // Built once, since they are used for most tokens
+	heredocSepFn             acceptFn // Separators, except the linebreak where a here-document starts
+}
 
-	tokens chan Token // Where to emit the result
+// Returns the longest operator found at pos, or an empty string
+func (s *scanner) operatorAt(pos int) (op string) {
+	for _, o := range s.cfg.Operators {
+		if len(o) > len(op) && strings.HasPrefix(s.input[pos:], o) {
+			op = o
+		}
+	}
+	return
 }
 
 func (s *scanner) next() rune {
@@ -135,6 +351,7 @@ func (s *scanner) next() rune {
 		return eof
 	}
 	r, w := utf8.DecodeRuneInString(s.input[s.pos:])
+	s.prev = s.pos
 	s.pos += w
 	return r
 }
@@ -153,10 +370,50 @@ func (s *scanner) skip() {
 }
 
 func (s *scanner) emit(t TokenType, incomp bool) {
-	s.tokens <- Token{t, s.input[s.start:s.pos], incomp}
+	val := s.input[s.start:s.pos]
+	incomp = incomp || s.unterminated
+	s.unterminated = false
+	s.tokens = append(s.tokens, Token{Type: t, Pos: s.start, Col: s.col, val: val, incomplete: incomp, cfg: s.cfg})
+	if reason, sp := s.malformed(t, val); reason != "" {
+		tok := &s.tokens[len(s.tokens)-1]
+		tok.Type = TokenError
+		tok.lexErr = &LexicalError{Reason: reason, Span: Span{s.start + sp.Start, s.start + sp.End}}
+	}
+	if t == TokenOperator && val == heredocOperator {
+		s.heredocNext = true
+	} else if s.heredocNext && t&TokenNoWhitespace != 0 {
+		s.heredocs = append(s.heredocs, s.tokens[len(s.tokens)-1].Value())
+		s.heredocNext = false
+	}
+	for _, r := range val {
+		if r == '\n' {
+			s.col = 0
+		} else {
+			s.col++
+		}
+	}
 	s.start = s.pos
 }
 
+// Finds invalid UTF-8 and control characters in val, and escapes at the end of the input.
+// Returns the reason and the span within val, or an empty reason if val is fine.
+func (s *scanner) malformed(t TokenType, val string) (string, Span) {
+	for i := 0; i < len(val); {
+		r, w := utf8.DecodeRuneInString(val[i:])
+		if r == utf8.RuneError && w == 1 {
+			return fmt.Sprintf("Invalid UTF-8 byte 0x%02x", val[i]), Span{i, i + 1}
+		} else if unicode.IsControl(r) && !unicode.IsSpace(r) {
+			return fmt.Sprintf("Control character %U", r), Span{i, i + w}
+		}
+		i += w
+	}
+	if t == TokenString && s.pos == len(s.input) && s.cfg.endsWithEscape(val) {
+		w := utf8.RuneLen(s.cfg.Escape)
+		return "Escape at end of input", Span{len(val) - w, len(val)}
+	}
+	return "", Span{}
+}
+
 func (s *scanner) acceptWhile(af acceptFn) {
 	backup := s.pos
 	for r := s.next(); r != eof && af(r); r = s.next() {
@@ -165,62 +422,201 @@ func (s *scanner) acceptWhile(af acceptFn) {
 	s.pos = backup
 }
 
-func (s *scanner) run() {
+// Like acceptWhile, but the escape rune will always accept the rune after it.
+// If subst is true, a command substitution $(...) is accepted as a whole.
+func (s *scanner) acceptEscapedWhile(af acceptFn, subst bool) {
+	backup := s.pos
+	for r := s.next(); r != eof; r = s.next() {
+		if r == s.cfg.Escape && r != 0 {
+			s.next() // Escaped, so no questions asked
+		} else if subst && r == '$' && strings.HasPrefix(s.input[s.pos:], "(") {
+			s.pos++
+			s.unterminated = !s.skipSubstitution()
+		} else if !af(r) {
+			break
+		}
+		backup = s.pos
+	}
+	s.pos = backup
+}
+
+// Skips past the ) that matches a $(, where s.pos is right after the $(.
+// Quotes, escapes and nested substitutions are skipped as a whole. Returns false if we reached eof first.
+func (s *scanner) skipSubstitution() bool {
+	depth := 1
+	for {
+		r := s.next()
+		switch {
+		case r == eof:
+			return false
+		case r == s.cfg.Escape && r != 0:
+			s.next()
+		case r == '(':
+			depth++
+		case r == ')':
+			if depth--; depth == 0 {
+				return true
+			}
+		default:
+			if q := s.cfg.quoteOpenedBy(r); q != nil && !s.skipQuoted(q) {
+				return false
+			}
+		}
+	}
+}
+
+// Skips past the closing quote, where the open quote is already consumed. Returns false if we reached eof first.
+func (s *scanner) skipQuoted(q *QuotePair) bool {
+	for {
+		r := s.next()
+		switch {
+		case r == eof:
+			return false
+		case r == s.cfg.Escape && r != 0:
+			s.next()
+		case r == q.Close:
+			return true
+		case q.Type == TokenDQuoted && r == '$' && strings.HasPrefix(s.input[s.pos:], "("):
+			s.pos++
+			if !s.skipSubstitution() {
+				return false
+			}
+		}
+	}
+}
+
+func (s *scanner) run() TokenSet {
 	for s.state != nil {
 		s.state = s.state(s)
 	}
-	close(s.tokens)
+	if len(s.heredocs) > 0 {
+		// The here-document has not started yet, so we need more lines
+		s.emit(TokenHeredoc, true)
+	}
+	return s.tokens
 }
 
-func Tokenize(input string) (tokens TokenSet) {
-	s := scanner{
-		input:  input,
-		state:  scanStart,
-		tokens: make(chan Token, 2),
+// Tokenizes input, reusing the tokens in ts that are not affected by the edit from ts.String() to input.
+// Only the suffix starting at the first changed token is scanned again.
+// The result may share memory with ts, so ts should not be used afterwards.
+func (ts TokenSet) Retokenize(input string) TokenSet {
+	keep := 0
+	// A token is still valid if its text is unchanged, and so is the start of the next token,
+	// since that is what terminated the token. We need to look as far as the longest operator.
+	lookahead := utf8.UTFMax
+	if len(ts) > 0 && ts[0].config().maxOperatorLen() > lookahead {
+		lookahead = ts[0].config().maxOperatorLen()
 	}
-	go s.run()
-	for tok := range s.tokens {
-		tokens = append(tokens, tok)
+	for ; keep+1 < len(ts); keep++ {
+		t, next := &ts[keep], &ts[keep+1]
+		end := t.Pos + len(t.val)
+		if end >= len(input) || next.val == "" || input[t.Pos:end] != t.val {
+			break
+		}
+		n := lookahead
+		if n > len(next.val) {
+			n = len(next.val)
+		}
+		if !strings.HasPrefix(input[end:], next.val[:n]) {
+			break
+		}
+	}
+	if keep == 0 {
+		if len(ts) == 0 {
+			return Tokenize(input)
+		}
+		return ts[0].config().Tokenize(input)
 	}
-	return
-}
 
-//
-func buildEscapeSafeAcceptFn(af acceptFn) acceptFn {
-	skipOne := false
-	return func(r rune) bool {
-		if skipOne {
-			skipOne = false
-			return true
-		} else if r == '\\' {
-			skipOne = true
-			return true
+	for idx := range ts[:keep] {
+		if ts[idx].Type == TokenOperator && ts[idx].val == heredocOperator {
+			return ts[0].config().Tokenize(input) // The scanner must know about the pending here-documents
 		}
-		return af(r)
 	}
+
+	last := ts[keep-1]
+	return last.config().newScanner(input, last.Pos+len(last.val), ts[keep].Col, ts[:keep]).run()
 }
 
 // States
 // scanStart is the defaultState, which will search for the start of another state and switch to that
 func scanStart(s *scanner) stateFn {
-	s.acceptWhile(unicode.IsSpace)
-	switch s.peek() {
-	case eof:
+	if len(s.heredocs) > 0 {
+		s.acceptWhile(s.heredocSepFn)
+		if s.peek() == '\n' {
+			s.next()
+			s.skip()
+			return scanHeredoc
+		}
+	}
+	s.acceptWhile(s.sepFn)
+	r := s.peek()
+	if r == eof {
 		s.emit(TokenEOF, false)
-		break
-	case '"':
-		s.skip()
-		return makeGenericTypeScanner(TokenDQuoted, true, scanStart,
-			accepTimes(1), untilRuneAcceptFn('"'), accepTimes(1))
-	case '\'':
-		s.skip()
-		return makeGenericTypeScanner(TokenSQuoted, true, scanStart,
-			accepTimes(1), untilRuneAcceptFn('\''), accepTimes(1))
-	default:
-		s.skip()
-		return makeGenericTypeScanner(TokenString, true, scanStart, invertAcceptFn(unicode.IsSpace))
+		return nil
 	}
-	return nil
+	s.skip()
+	if op := s.operatorAt(s.pos); op != "" {
+		s.pos += len(op)
+		s.emit(TokenOperator, false)
+		if eof == s.peek() {
+			return nil
+		}
+		return scanStart
+	} else if r == s.cfg.Comment && r != 0 {
+		return scanComment
+	} else if q := s.cfg.quoteOpenedBy(r); q != nil {
+		return makeGenericTypeScanner(q.Type, true, scanStart,
+			accepTimes(1), untilRuneAcceptFn(q.Close), accepTimes(1))
+	}
+	return scanWord
+}
+
+// scanWord scans a unquoted string. It is the most common state, so we avoid building a new scanner each time
+func scanWord(s *scanner) stateFn {
+	s.acceptEscapedWhile(s.wordFn, true)
+	s.emit(TokenString, false)
+	if eof == s.peek() {
+		return nil
+	}
+	return scanStart
+}
+
+// scanHeredoc scans the lines of a here-document, until a line with only the terminator
+func scanHeredoc(s *scanner) stateFn {
+	term := s.heredocs[0]
+	s.heredocs = s.heredocs[1:]
+	for {
+		end := strings.IndexByte(s.input[s.pos:], '\n')
+		if end < 0 {
+			end = len(s.input) - s.pos
+		}
+		line := s.input[s.pos : s.pos+end]
+		s.pos += end
+		if strings.TrimSuffix(line, "\r") == term {
+			s.emit(TokenHeredoc, false)
+			break
+		} else if s.pos == len(s.input) {
+			s.emit(TokenHeredoc, true)
+			s.heredocs = nil // The rest can not start before this ends
+			return nil
+		}
+		s.next() // The linebreak
+	}
+	if eof == s.peek() {
+		return nil
+	}
+	return scanStart
+}
+
+// scanComment scans until end of line. The linebreak is left for scanStart
+func scanComment(s *scanner) stateFn {
+	s.acceptWhile(s.untilLine)
+	s.emit(TokenComment, false)
+	if eof == s.peek() {
+		return nil
+	}
+	return scanStart
 }
 
 // Helper acceptFn.  Accepts N characters, no questions asked
@@ -274,7 +670,7 @@ func makeGenericTypeScanner(typ TokenType, backslashSafe bool, nextState stateFn
 	af, methLeft := chainAcceptFn(afs...)
 	return func(s *scanner) stateFn {
 		if backslashSafe {
-			s.acceptWhile(buildEscapeSafeAcceptFn(af))
+			s.acceptEscapedWhile(af, typ == TokenDQuoted)
 		} else {
 			s.acceptWhile(af)
 		}
@@ -1,6 +1,7 @@
 package gocop
 
 import (
+	"fmt"
 	"strings"
 	"testing"
 
@@ -43,13 +44,11 @@ func TestAcceptWhile_simple(t *testing.T) {
 
 func TestAcceptWhile_EscapeWrapper(t *testing.T) {
 	testStr := "Skip this \\\" quote. \" is the one"
-	scanner := scanner{input: testStr}
+	scanner := scanner{input: testStr, cfg: &DefaultLexerConfig}
 
-	escScan := buildEscapeSafeAcceptFn(func(r rune) bool {
+	scanner.acceptEscapedWhile(func(r rune) bool {
 		return r != '"'
-	})
-
-	scanner.acceptWhile(escScan)
+	}, false)
 
 	if scanner.pos != strings.LastIndex(testStr, "\"") {
 		t.Error("Expected same index as strings.Index: ", scanner.pos, " != ", strings.Index(testStr, " "))
@@ -111,3 +110,212 @@ func ExampleTokenSet_Filter() {
 
 	log.Print("Filtered on single or double quoted string: ", tokens.Filter(TokenSQuoted|TokenDQuoted))
 }
+
+func TestTokenSet_NeedsContinuation(t *testing.T) {
+	check := func(input string, expected bool) {
+		if Tokenize(input).NeedsContinuation() != expected {
+			t.Errorf("Expected NeedsContinuation to be %v for '%s'", expected, input)
+		}
+	}
+
+	check("cmd arg", false)
+	check("cmd 'open single", true)
+	check("cmd \"open double", true)
+	check("cmd \"closed double\"", false)
+	check("cmd arg \\", true)
+	check("cmd arg\\", true)
+	check("cmd arg\\\\", false)
+	check("cmd arg\\ ", false)
+	check("", false)
+	check("cmd <<EOF", true)
+	check("cmd <<EOF\nline", true)
+	check("cmd <<EOF\nline \"open\n", true)
+	check("cmd <<EOF\nline\nEOF", false)
+	check("cmd <<EOF\nline \\\nEOF", false)
+}
+
+func TestTokenize_Errors(t *testing.T) {
+	check := func(input string, expected ...string) {
+		var res []string
+		for _, tok := range Tokenize(input) {
+			if tok.Type == TokenError {
+				res = append(res, fmt.Sprintf("%q: %s %v", tok.val, tok.lexErr.Reason, tok.lexErr.Span))
+			}
+		}
+		t.Logf("Errors in %q: %v", input, res)
+		assertEqual(t, fmt.Sprint(expected), fmt.Sprint(res))
+		assertEqual(t, input, Tokenize(input).String())
+	}
+
+	check("cmd arg")
+	check("cmd a\xffb c", `"a\xffb": Invalid UTF-8 byte 0xff {5 6}`)
+	check("cmd \x1b[0m", `"\x1b[0m": Control character U+001B {4 5}`)
+	check("cmd \"a\x00\" \x01", `"\"a\x00\"": Control character U+0000 {6 7}`, `"\x01": Control character U+0001 {9 10}`)
+	check("cmd <<EOF\n\x02\nEOF", `"\x02\nEOF": Control character U+0002 {10 11}`)
+	check("cmd arg\\", `"arg\\": Escape at end of input {7 8}`)
+	check("cmd arg\\\\")
+	check("cmd 'arg\\")
+	check("cmd\targ\r\n\v\f")
+	check("cmd ÅÄÖ ✓")
+
+	if !Tokenize("cmd arg\\").NeedsContinuation() {
+		t.Error("Expected a stray escape to still need continuation")
+	}
+}
+
+func TestToken_Value(t *testing.T) {
+	cfg := DefaultLexerConfig
+	check := func(input, expected string) {
+		tokens := cfg.Tokenize(input)
+		assertEqual(t, expected, tokens.Value())
+		assertEqual(t, input, tokens.String())
+	}
+
+	check(`"say \"hi\""`, `say "hi"`)
+	check(`'it\'s'`, `it's`)
+	check(`a\ b`, `a b`)
+	check(`back\\slash`, `back\slash`)
+	check(`keep\n\x41\d`, `keep\n\x41\d`)
+	check(`"two words"   and\ more`, `two words   and more`)
+	check(`trailing\`, `trailing\`)
+
+	cfg.CStyleEscapes = true
+
+	check(`"line\nnext\ttab"`, "line\nnext\ttab")
+	check(`\x41å\U0001F600`, "Aå\U0001F600")
+	check(`unknown\d`, `unknown\d`)
+}
+
+func TestTokenize_Positions(t *testing.T) {
+	tokens := Tokenize("åäö \"quoted\"\n  next")
+	expected := []struct{ pos, col int }{{0, 0}, {6, 3}, {7, 4}, {15, 12}, {18, 2}}
+	if len(tokens) != len(expected) {
+		t.Fatal("Expected ", len(expected), " tokens, but got ", tokens)
+	}
+	for i, e := range expected {
+		if tokens[i].Pos != e.pos || tokens[i].Col != e.col {
+			t.Errorf("Expected token %d (%s) at %d:%d, but got %d:%d", i, tokens[i].val, e.pos, e.col, tokens[i].Pos, tokens[i].Col)
+		}
+	}
+}
+
+func TestSpan_Marker(t *testing.T) {
+	input := "cmd\tfirst second"
+	tokens := Tokenize(input).Filter(TokenNoWhitespace)
+	assertEqual(t, "cmd\tfirst second\n   \t^~~~~\n", tokens[1].Span().Marker(input))
+	assertEqual(t, "cmd\tfirst second\n   \t            ^\n", Span{16, 16}.Marker(input))
+	assertEqual(t, "second line\n       ^~~~\n", Span{13, 17}.Marker("first\nsecond line"))
+}
+
+func TestTokenSet_Retokenize(t *testing.T) {
+	lines := []string{
+		"",
+		"/msg bob",
+		"/msg bob ",
+		"/msg bob \"hello there",
+		"/msg bob \"hello there\" and 'more'",
+		"/msg bob \"hello there\" and 'more'\\ ",
+		"/msg bob \"hello there\" and 'more'\\",
+		"/msg bo",
+		"/msg  bob\u0085x",
+		"/msg  bob©x",
+		"/join #a",
+		"",
+	}
+
+	var tokens TokenSet
+	for _, l := range lines {
+		tokens = tokens.Retokenize(l)
+		expected := Tokenize(l)
+		if fmt.Sprintf("%+v", tokens) != fmt.Sprintf("%+v", expected) {
+			t.Errorf("Retokenize of '%s' gave\n%+v\nbut expected\n%+v", l, tokens, expected)
+		}
+	}
+}
+
+var benchmarkLine = "/msg someone \"This is a long message\" with\\ escapes and 'quoted strings' that goes on and on"
+
+func BenchmarkTokenize(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		Tokenize(benchmarkLine)
+	}
+}
+
+// Simulates typing the last word, and tokenizing on each keystroke
+func BenchmarkTokenizeTyping(b *testing.B) {
+	start := strings.LastIndex(benchmarkLine, " ")
+	for i := 0; i < b.N; i++ {
+		for l := start; l <= len(benchmarkLine); l++ {
+			Tokenize(benchmarkLine[:l])
+		}
+	}
+}
+
+func BenchmarkRetokenizeTyping(b *testing.B) {
+	start := strings.LastIndex(benchmarkLine, " ")
+	for i := 0; i < b.N; i++ {
+		tokens := Tokenize(benchmarkLine[:start])
+		for l := start; l <= len(benchmarkLine); l++ {
+			tokens = tokens.Retokenize(benchmarkLine[:l])
+		}
+	}
+}
+
+func TestLexerConfig_Tokenize(t *testing.T) {
+	cfg := LexerConfig{
+		Quotes:     []QuotePair{{'«', '»', TokenDQuoted}, {'"', '"', TokenSQuoted}},
+		Separators: []rune{','},
+		Comment:    '#',
+	}
+
+	tokens := cfg.Tokenize(`copy «C:\Program Files\» "a b",c:\tmp\ # the rest\`)
+	t.Log("Tokens: ", tokens)
+	expected := []string{"copy", `C:\Program Files\`, "a b", `c:\tmp\`}
+	words := tokens.Filter(TokenNoWhitespace)
+	if len(words) != len(expected) {
+		t.Fatal("Expected ", expected, " but got ", words)
+	}
+	for i, e := range expected {
+		assertEqual(t, e, words[i].Value())
+	}
+	if last := tokens[len(tokens)-1]; last.Type != TokenComment || last.val != `# the rest\` {
+		t.Error("Expected the line to end with a comment, but got ", last)
+	}
+	if tokens.NeedsContinuation() {
+		t.Error("Comments and backslashes should not continue the line")
+	}
+
+	if cfg.Tokenize("cmd « open").NeedsContinuation() != true {
+		t.Error("Expected unterminated « to continue the line")
+	}
+	assertEqual(t, "a#b", cfg.Tokenize("a#b #c").Value())
+
+	cfg.Escape = '^'
+	assertEqual(t, `a b^"\`, cfg.Tokenize(`a^ b^^^"\`).Value())
+}
+
+func TestTokenize_Operators(t *testing.T) {
+	tokens := Tokenize(`a;b && c||d 'e;f' g\;h i&j`)
+	t.Log("Tokens: ", tokens)
+	ops := tokens.Filter(TokenOperator)
+	if len(ops) != 3 || ops[0].val != ";" || ops[1].val != "&&" || ops[2].val != "||" {
+		t.Error("Expected the operators ;, && and ||, but got ", ops)
+	}
+	words := tokens.Filter(TokenNoWhitespace)
+	expected := []string{"a", "b", "c", "d", "e;f", "g;h", "i&j"}
+	for i, e := range expected {
+		assertEqual(t, e, words[i].Value())
+	}
+
+	if !Tokenize("cmd && ").NeedsContinuation() || Tokenize("cmd ;").NeedsContinuation() {
+		t.Error("Expected && to continue the line, but not ;")
+	}
+
+	// Retokenize must notice when an operator is split or joined
+	for _, pair := range [][2]string{{"ab&&x", "ab&|x"}, {"ab&x", "ab&&x"}, {"a |b", "a ||b"}} {
+		got := fmt.Sprintf("%+v", Tokenize(pair[0]).Retokenize(pair[1]))
+		if exp := fmt.Sprintf("%+v", Tokenize(pair[1])); got != exp {
+			t.Errorf("Retokenize from '%s' to '%s' gave %s, but expected %s", pair[0], pair[1], got, exp)
+		}
+	}
+}
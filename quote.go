@@ -0,0 +1,80 @@
+// Copyright (c) 2016 Forau @ github.com. MIT License.
+
+package gocop
+
+import (
+	"bytes"
+	"strings"
+)
+
+// Quote with DefaultLexerConfig
+func Quote(str string) string {
+	return DefaultLexerConfig.Quote(str)
+}
+
+// Join with DefaultLexerConfig
+func Join(args []string) string {
+	return DefaultLexerConfig.Join(args)
+}
+
+// Quotes the arguments, and joins them with spaces, so Tokenize returns them again
+func (cfg *LexerConfig) Join(args []string) string {
+	quoted := make([]string, len(args))
+	for idx, arg := range args {
+		quoted[idx] = cfg.Quote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// Returns str quoted or escaped, so it is tokenized as one argument with str as value.
+// We use the shortest of escaping the special runes and the quotes in the config. Escaping wins a tie,
+// since a quoted path can not be continued by autocomplete.
+// Variables, substitutions and braces are also protected from expansion.
+// Invalid UTF-8 and control characters can not be quoted, since the lexer rejects them.
+func (cfg *LexerConfig) Quote(str string) string {
+	if str != "" && strings.IndexFunc(str, cfg.isSpecial) < 0 {
+		return str
+	}
+
+	best, found := str, false
+	if cfg.Escape != 0 && str != "" {
+		var buf bytes.Buffer
+		for _, r := range str {
+			if cfg.isSpecial(r) {
+				buf.WriteRune(cfg.Escape)
+			}
+			buf.WriteRune(r)
+		}
+		best, found = buf.String(), true
+	}
+
+	for _, q := range cfg.Quotes {
+		cand, ok := cfg.quoteWith(q, str)
+		if ok && (!found || len(cand) < len(best)) {
+			best, found = cand, true
+		}
+	}
+	return best
+}
+
+// Puts str in the quotes, and escapes what must be escaped. Returns false if we can not.
+func (cfg *LexerConfig) quoteWith(q QuotePair, str string) (string, bool) {
+	var buf bytes.Buffer
+	buf.WriteRune(q.Open)
+	for _, r := range str {
+		// Double quotes expand variables and substitutions, so $ is escaped there
+		if r == q.Close || (r == cfg.Escape && r != 0) || (r == '$' && q.Type == TokenDQuoted) {
+			if cfg.Escape == 0 {
+				return "", false
+			}
+			buf.WriteRune(cfg.Escape)
+		}
+		buf.WriteRune(r)
+	}
+	buf.WriteRune(q.Close)
+
+	// Check that the lexer agrees, in case the quotes are also separators or operators
+	tokens := cfg.Tokenize(buf.String()).Filter(^TokenAllWhitespace)
+	ok := len(tokens) == 1 && tokens[0].Type == q.Type && !tokens[0].incomplete && tokens[0].Value() == str
+	return buf.String(), ok
+}
@@ -0,0 +1,122 @@
+// Copyright (c) 2016 Forau @ github.com. MIT License.
+
+package gocop
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/quick"
+	"unicode"
+)
+
+// Splits the input the way the parser does, into decoded values
+func tokenValues(cfg *LexerConfig, input string) (ret []string) {
+	for _, t := range cfg.Tokenize(input) {
+		if !t.IsWhitespace() {
+			ret = append(ret, t.Value())
+		}
+	}
+	return
+}
+
+func TestQuote(t *testing.T) {
+	check := func(input, expected string) {
+		res := Quote(input)
+		t.Logf("Quote(%q) = %s", input, res)
+		assertEqual(t, expected, res)
+	}
+
+	check("plain", "plain")
+	check("", `""`)
+	check("two words", `two\ words`)
+	check("channel topic with many words", `"channel topic with many words"`)
+	check("it's", `it\'s`)
+	check(`say "hi" it's nice`, `'say "hi" it\'s nice'`)
+	check("$HOME", `\$HOME`)
+	check("costs $5 and $(date) now", `'costs $5 and $(date) now'`)
+	check("a;b", `a\;b`)
+	check("a {b,c} d", `"a {b,c} d"`)
+	check(`C:\dir\file`, `C:\\dir\\file`)
+	check("åäö✓", "åäö✓")
+
+	cfg := DefaultLexerConfig
+	cfg.Escape = 0
+	assertEqual(t, `"it's"`, cfg.Quote("it's"))
+	assertEqual(t, `'"$HOME"'`, cfg.Quote(`"$HOME"`))
+	assertEqual(t, `C:\dir\file`, cfg.Quote(`C:\dir\file`))
+}
+
+func TestJoin(t *testing.T) {
+	args := []string{"/msg", "bob smith", "", "it's a \"test\"", "a|b", "#{dev,ops}"}
+	joined := Join(args)
+	t.Log("Joined: ", joined)
+	assertEqual(t, fmt.Sprintf("%q", args), fmt.Sprintf("%q", tokenValues(&DefaultLexerConfig, joined)))
+
+	// Nothing in the quoted arguments is expanded
+	log := []string{}
+	cp := newTestParser(&log)
+	cp.Vars.Set("x", "expanded")
+	res, _ := cp.Execute(Join([]string{"ok", "$x {a,b} $(ok y) *"}))
+	assertEqual(t, "$x {a,b} $(ok y) *", fmt.Sprint(res))
+}
+
+// Generates strings with a lot of runes that are special to the lexer
+type lexerString string
+
+func (lexerString) Generate(rand *rand.Rand, size int) reflect.Value {
+	runes := []rune(` "'\$(){},;|&<>#*?[]` + "\t\nabcåäö✓")
+	var buf []rune
+	for i := rand.Intn(size + 1); i > 0; i-- {
+		if rand.Intn(4) == 0 {
+			buf = append(buf, rune(rand.Intn(0x3000)))
+		} else {
+			buf = append(buf, runes[rand.Intn(len(runes))])
+		}
+	}
+	return reflect.ValueOf(lexerString(buf))
+}
+
+func TestJoin_RoundTrip(t *testing.T) {
+	configs := []LexerConfig{DefaultLexerConfig, DefaultLexerConfig, DefaultLexerConfig}
+	configs[1].Comment = '#'
+	configs[1].Separators = []rune{','}
+	configs[2].Escape = 0
+
+	for idx := range configs {
+		cfg := &configs[idx]
+		prop := func(args []lexerString) bool {
+			var in []string
+			for _, a := range args {
+				// The lexer rejects control characters, so they can not round trip
+				in = append(in, strings.Map(func(r rune) rune {
+					if unicode.IsControl(r) && !unicode.IsSpace(r) {
+						return -1
+					}
+					return r
+				}, string(a)))
+			}
+			if cfg.Escape == 0 {
+				for _, a := range in {
+					if strings.ContainsRune(a, '\'') && strings.ContainsAny(a, `"$`) {
+						return true // Without an escape rune, neither of the quotes can hold this
+					}
+				}
+			}
+			joined := cfg.Join(in)
+			out := tokenValues(cfg, joined)
+			if len(in) == 0 && len(out) == 0 {
+				return true
+			} else if !reflect.DeepEqual(in, out) {
+				t.Logf("Join(%q) = %s, but tokenized to %q", in, joined, out)
+				return false
+			}
+			return true
+		}
+		if err := quick.Check(prop, &quick.Config{MaxCount: 1000}); err != nil {
+			t.Errorf("Config %d: %v", idx, err)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2016 Forau @ github.com. MIT License.
+
+package gocop
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Renders a result to a string
+type RenderFn func(res interface{}) string
+
+// Renders the result the same way as DefaultResultHandler prints it
+func DefaultRenderer(res interface{}) string {
+	return fmt.Sprintf("%+v", res)
+}
+
+func isRedirect(t *Token) bool {
+	return t.Type == TokenOperator && (t.val == ">" || t.val == ">>")
+}
+
+// Where to write the result of a command, from > or >>
+type redirect struct {
+	op   *Token
+	path string
+}
+
+// Removes a redirect, and the path after it, from the tokens.
+// The redirect can be anywhere in the command, but only once.
+func extractRedirect(line string, ts TokenSet) (cmd TokenSet, r *redirect, err error) {
+	for idx := range ts {
+		if !isRedirect(&ts[idx]) {
+			continue
+		}
+		if r != nil {
+			return nil, nil, &InvalidArgument{msg: "Only one redirect is allowed", input: line, Span: ts[idx].Span()}
+		}
+		pathIdx := idx + 1
+		for pathIdx < len(ts) && ts[pathIdx].IsWhitespace() {
+			pathIdx++
+		}
+		if pathIdx == len(ts) || ts[pathIdx].Type&TokenNoWhitespace == 0 {
+			return nil, nil, &InvalidArgument{msg: "Missing file after: " + ts[idx].val, input: line, Span: ts[idx].Span()}
+		}
+		r = &redirect{op: &ts[idx], path: ts[pathIdx].Value()}
+		cmd = append(append(TokenSet{}, ts[:idx]...), ts[pathIdx+1:]...)
+	}
+	if r == nil {
+		return ts, nil, nil
+	}
+	if !cmd.HasText() {
+		return nil, nil, &InvalidArgument{msg: "Missing command before: " + r.op.val, input: line, Span: r.op.Span()}
+	}
+	return
+}
+
+// Writes the rendered result to the file, truncating with > and appending with >>
+func (r *redirect) write(res interface{}, render RenderFn) error {
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if r.op.val == ">>" {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	f, err := os.OpenFile(r.path, flags, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if res != nil {
+		out := render(res)
+		if !strings.HasSuffix(out, "\n") {
+			out += "\n"
+		}
+		if _, err = f.WriteString(out); err != nil {
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// If the tokens end with a redirect, and maybe a partial path, we return the tokens before the path, and the partial path
+func redirectTarget(ts TokenSet) (prefix TokenSet, partial string, ok bool) {
+	end := len(ts)
+	if end > 0 && ts[end-1].Type&(TokenNoWhitespace|TokenEOF) != 0 {
+		partial = ts[end-1].Value()
+		end--
+	}
+	prefix = ts[:end]
+	for end > 0 && ts[end-1].Type == TokenWhitespace {
+		end--
+	}
+	ok = end > 0 && isRedirect(&ts[end-1])
+	return
+}
+
+// Sugests files and directories starting with partial. Directories end with a separator.
+func (cfg *LexerConfig) completeFile(partial string) (ret []string) {
+	matches, _ := filepath.Glob(escapeGlob(partial) + "*")
+	for _, m := range matches {
+		if strings.HasPrefix(partial, "./") && !strings.HasPrefix(m, "./") {
+			m = "./" + m // Glob cleans the path, but we must keep what the user typed
+		}
+		if fi, err := os.Stat(m); err == nil && fi.IsDir() {
+			m += string(filepath.Separator)
+		}
+		ret = append(ret, cfg.Quote(m))
+	}
+	return
+}
+
+// Escapes the runes that are special to Glob
+func escapeGlob(str string) string {
+	if filepath.Separator == '\\' {
+		return str // Can not escape on windows, but it is not likely to matter
+	}
+	return strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`).Replace(str)
+}
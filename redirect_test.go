@@ -0,0 +1,97 @@
+// Copyright (c) 2016 Forau @ github.com. MIT License.
+
+package gocop
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCommandParser_ExecuteRedirect(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "out file.txt")
+
+	log := []string{}
+	cp := newTestParser(&log)
+	cp.Vars.Set("out", file)
+	cp.world.AddSubCommand("/raw").AddArgument("data").Times(1, 999).Handler(func(rc RunContext) (interface{}, error) {
+		return rc.Get("data"), nil
+	})
+
+	readFile := func() string {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Error(err)
+		}
+		return string(data)
+	}
+
+	res, err := cp.Execute("/raw first line > $out")
+	if res != nil || err != nil {
+		t.Error("Expected the result to go to the file, but got ", res, err)
+	}
+	assertEqual(t, "first line\n", readFile())
+
+	cp.Execute("/raw >>\"$out\" second line")
+	assertEqual(t, "first line\nsecond line\n", readFile())
+
+	cp.Execute("/raw third > $out && /raw quoted '>' stays")
+	assertEqual(t, "third\n", readFile())
+
+	cp.Execute("help > $out")
+	if !strings.HasPrefix(readFile(), "Usage:\n") {
+		t.Error("Expected help in file, but got ", readFile())
+	}
+
+	for _, bad := range []string{"/raw a >", "/raw a > b > c", "> b", "/raw a > ;"} {
+		if _, err := cp.Execute(bad); err == nil {
+			t.Error("Expected error for ", bad)
+		}
+	}
+	// The marker points into the line as typed, even though the redirect is removed before assignment
+	_, err = cp.Execute("ok a > out.txt extra")
+	if ia, ok := err.(*InvalidArgument); !ok {
+		t.Error("Expected InvalidArgument, but got ", err)
+	} else {
+		assertEqual(t, "ok a > out.txt extra\n               ^~~~~\n", ia.Marker())
+	}
+	_, err = cp.Execute("ok a; nope > out.txt")
+	if ia, ok := err.(*InvalidArgument); !ok {
+		t.Error("Expected InvalidArgument, but got ", err)
+	} else {
+		assertEqual(t, "nope > out.txt\n^~~~\n", ia.Marker())
+	}
+}
+
+func TestCommandParser_AutoCompleteRedirect(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Mkdir(filepath.Join(dir, "sub dir"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "some file"), nil, 0644)
+	ioutil.WriteFile(filepath.Join(dir, "other"), nil, 0644)
+
+	log := []string{}
+	cp := newTestParser(&log)
+
+	escDir := cp.Lexer.Quote(dir)
+	sug := cp.AutoCompleter("ok a > " + escDir + "/s")
+	expected := []string{"ok a > " + escDir + "/some\\ file", "ok a > " + escDir + "/sub\\ dir/"}
+	if strings.Join(sug, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected %v, but got %v", expected, sug)
+	}
+
+	sug = cp.AutoCompleter("ok a >" + escDir + "/ot")
+	if len(sug) != 1 || sug[0] != "ok a >"+escDir+"/other" {
+		t.Error("Expected other file, but got ", sug)
+	}
+}
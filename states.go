@@ -0,0 +1,80 @@
+// Copyright (c) 2016 Forau @ github.com. MIT License.
+
+package gocop
+
+// A warning about a command that is run, like that it is deprecated.
+// It is reported to the ResultHandler before the command runs.
+type Warning string
+
+func (w Warning) String() string {
+	return "Warning: " + string(w)
+}
+
+// Leaves the node out of autocomplete and usage. It can still be used.
+func (an *ArgNode) Hidden() *ArgNode {
+	an.TypeFlags |= HiddenNode
+	return an
+}
+
+// Marks the node as deprecated. It can still be used, but gives a warning with the message, like "use /connect".
+// Only CommandParser.Execute reports the warning, to the ResultHandler. ArgNode.InvokeCommand runs the node without it.
+func (an *ArgNode) Deprecated(msg string) *ArgNode {
+	an.TypeFlags |= DeprecatedNode
+	an.Deprecation = msg
+	return an
+}
+
+// Marks the node as experimental. It can only be used with the AllowExperimental option,
+// and is hidden without it.
+func (an *ArgNode) Experimental() *ArgNode {
+	an.TypeFlags |= ExperimentalNode
+	return an
+}
+
+func (an *ArgNode) isHidden() bool {
+	return an.TypeFlags&HiddenNode != 0 || an.isDisabled()
+}
+
+// Checks if the node is experimental, without the option to allow it
+func (an *ArgNode) isDisabled() bool {
+	return an.TypeFlags&ExperimentalNode != 0 && an.parserOptions()&AllowExperimental == 0
+}
+
+// The name as it is typed, like --verbose for a flag
+func (an *ArgNode) typedName() string {
+	if an.TypeFlags&FlagNode != 0 {
+		return "--" + an.Name
+	}
+	return an.Name
+}
+
+// Calls fn for each assignment on the path, and the flags after them
+func (cap *commandAssignPath) eachAssignment(fn func(ass *argNodeAssignment)) {
+	for idx := range *cap {
+		fn(&(*cap)[idx])
+		for fi := range (*cap)[idx].flags {
+			fn(&(*cap)[idx].flags[fi])
+		}
+	}
+}
+
+// Returns an error for the first experimental node on the path, unless they are allowed
+func (cap *commandAssignPath) checkExperimental() (err error) {
+	cap.eachAssignment(func(ass *argNodeAssignment) {
+		if err == nil && ass.Node.isDisabled() {
+			err = &InvalidArgument{msg: ass.Node.typedName() + " is experimental, and needs the AllowExperimental option",
+				Span: ass.Tokens.Span()}
+		}
+	})
+	return
+}
+
+// Returns a warning for each deprecated node on the path
+func (cap *commandAssignPath) warnings() (ret []Warning) {
+	cap.eachAssignment(func(ass *argNodeAssignment) {
+		if ass.Node.TypeFlags&DeprecatedNode != 0 {
+			ret = append(ret, Warning(ass.Node.typedName()+" is deprecated: "+ass.Node.Deprecation))
+		}
+	})
+	return
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2016 Forau @ github.com. MIT License.
+
+package gocop
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// Adds commands in different states to the test parser
+func newStatesParser(log *[]string) *CommandParser {
+	cp := newTestParser(log)
+	handler := func(rc RunContext) (interface{}, error) {
+		*log = append(*log, "run "+rc.Get("state.arg")+rc.Get("old")+rc.Get("beta"))
+		return "done", nil
+	}
+	cp.world.AddSubCommand("/secret").Hidden().Handler(handler)
+	cp.world.AddSubCommand("/server").Deprecated("use /connect").Handler(handler).AddArgument("state.arg").Optional()
+	cp.world.AddSubCommand("/beta").Experimental().Handler(handler)
+	opts := cp.world.AddSubCommand("/opts").Handler(handler)
+	opts.AddFlag("old", 0).Deprecated("it does nothing")
+	opts.AddFlag("beta", 'b').Experimental()
+	opts.AddFlag("hush", 0).Hidden()
+	opts.AddArgument("state.arg").Optional().Hidden()
+	cp.world.AddSubCommand("/link").Handler(handler).AddArgument("state.server").AddArgument("state.nick").Optional().Hidden().
+		AddArgument("state.user").Optional()
+	return cp
+}
+
+func TestArgNode_States(t *testing.T) {
+	check := func(allow bool, line, expected string) {
+		log := []string{}
+		cp := newStatesParser(&log)
+		if allow {
+			cp.Options |= AllowExperimental
+		}
+		res, err := cp.Execute(line)
+		if err != nil {
+			err = errors.New(strings.Split(err.Error(), "\n")[0])
+		}
+		log = append(log, fmt.Sprintf("return(%v, %v)", res, err))
+		t.Logf("%q -> %s", line, strings.Join(log, "; "))
+		assertEqual(t, expected, strings.Join(log, "; "))
+	}
+
+	check(false, "/secret", "run ; return(done, <nil>)")
+	check(false, "/server", "result(Warning: /server is deprecated: use /connect, <nil>); run ; return(done, <nil>)")
+	check(false, "/beta", "return(<nil>, /beta is experimental, and needs the AllowExperimental option)")
+	check(true, "/beta", "run ; return(done, <nil>)")
+	check(false, "/opts --old x", "result(Warning: --old is deprecated: it does nothing, <nil>); run xtrue; return(done, <nil>)")
+	check(false, "/opts -b", "return(<nil>, --beta is experimental, and needs the AllowExperimental option)")
+	check(true, "/opts -b", "run true; return(done, <nil>)")
+	check(false, "ok $(/server x)", "result(Warning: /server is deprecated: use /connect, <nil>); run x; ok done; return(done, <nil>)")
+}
+
+func TestArgNode_StatesUsageAndSugestions(t *testing.T) {
+	log := []string{}
+	cp := newStatesParser(&log)
+
+	sugest := func(line string) string {
+		return strings.Join(cp.AutoCompleter(line), ",")
+	}
+	usage := func() string {
+		res, _ := cp.Execute("help")
+		return fmt.Sprint(res)
+	}
+
+	assertEqual(t, "/server", sugest("/s"))
+	assertEqual(t, "", sugest("/b"))
+	assertEqual(t, "/opts --old", sugest("/opts --"))
+	assertEqual(t, "false false true", fmt.Sprint(strings.Contains(usage(), "/secret"), strings.Contains(usage(), "/beta"),
+		strings.Contains(usage(), "/server")))
+	assertEqual(t, "true", fmt.Sprint(strings.Contains(usage(), "/opts [--old]\n")))
+	assertEqual(t, "true", fmt.Sprint(strings.Contains(usage(), "/link [state.server] [state.user?]\n")))
+
+	cp.Options |= AllowExperimental
+	assertEqual(t, "/beta", sugest("/b"))
+	assertEqual(t, "/opts --old,/opts --beta", sugest("/opts --"))
+	assertEqual(t, "true", fmt.Sprint(strings.Contains(usage(), "/opts [--old] [-b|--beta]\n")))
+}
@@ -0,0 +1,237 @@
+// Copyright (c) 2016 Forau @ github.com. MIT License.
+
+package gocop
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Converts the text of an argument to a typed value, or returns an error saying why it can not
+type ConvertFn func(str string) (interface{}, error)
+
+// The type of a typed argument
+type ArgType struct {
+	Name    string                        // Shown in usage, like [port:int]
+	Convert ConvertFn                     // Runs during path assignment, so a bad value fails the path
+	Hints   func(partial string) []string // Values to sugest for what is typed so far. Can be nil
+	Choices []string                      // The accepted values, if it is a choice
+}
+
+var (
+	IntType      = &ArgType{Name: "int", Convert: convertInt}
+	FloatType    = &ArgType{Name: "float", Convert: convertFloat}
+	BoolType     = &ArgType{Name: "bool", Convert: convertBool, Hints: boolHints}
+	DurationType = &ArgType{Name: "duration", Convert: convertDuration, Hints: unitHints("ms", "s", "m", "h")}
+	ByteSizeType = &ArgType{Name: "size", Convert: convertByteSize, Hints: unitHints("B", "KiB", "MiB", "GiB")}
+)
+
+// Adds an argument that is converted with typ. The text is available from RunContext.Get as usual,
+// and the converted value from RunContext.GetValue. Multi arguments get a slice of the values.
+func (an *ArgNode) AddTypedArgument(name string, typ *ArgType) *ArgNode {
+	n := an.AddCustomNode(name, getTypedSugestorFn(name), getTypedInvokerFn(name), typedArgumentAcceptorFn, ArgumentNode)
+	n.ArgType = typ
+	return n
+}
+
+// Adds an argument with an int64 value. Hex is allowed, like 0x1F
+func (an *ArgNode) AddIntArgument(name string) *ArgNode {
+	return an.AddTypedArgument(name, IntType)
+}
+
+// Adds an argument with a float64 value
+func (an *ArgNode) AddFloatArgument(name string) *ArgNode {
+	return an.AddTypedArgument(name, FloatType)
+}
+
+// Adds an argument with a bool value. Accepts true/false, yes/no, on/off and 1/0
+func (an *ArgNode) AddBoolArgument(name string) *ArgNode {
+	return an.AddTypedArgument(name, BoolType)
+}
+
+// Adds an argument with a time.Duration value, like 1h30m or 250ms
+func (an *ArgNode) AddDurationArgument(name string) *ArgNode {
+	return an.AddTypedArgument(name, DurationType)
+}
+
+// Adds an argument with a int64 value in bytes, like 512, 10MB or 1.5GiB.
+// KB, MB, GB and TB are powers of 1000, while K, M, G, T, KiB, MiB, GiB and TiB are powers of 1024.
+func (an *ArgNode) AddByteSizeArgument(name string) *ArgNode {
+	return an.AddTypedArgument(name, ByteSizeType)
+}
+
+// Like singleArgumentAcceptorFn, but the assignment gets an error if the value does not convert.
+// That makes the path lose, but we can still tell the user why.
+func typedArgumentAcceptorFn(node *ArgNode, in TokenSet) (accepted []argNodeAssignment) {
+	for _, na := range singleArgumentAcceptorFn(node, in) {
+		if _, err := node.ArgType.Convert(na.Tokens.Value()); err != nil && node.ArgType.Choices != nil {
+			na.err = fmt.Errorf("Invalid %s: %s", node.Name, err) // The name of the type is the choices, so skip it
+		} else if err != nil {
+			na.err = fmt.Errorf("Invalid %s for %s: %s", node.ArgType.Name, node.Name, err)
+		}
+		accepted = append(accepted, na)
+	}
+	return
+}
+
+func getTypedInvokerFn(name string) AcInvokerFn {
+	argInvoker := getArgumentInvokerFn(name)
+	return func(assignment *argNodeAssignment, context RunContext) {
+		argInvoker(assignment, context)
+
+		typ := assignment.Node.ArgType
+		var values []interface{}
+		for idx := range assignment.Tokens {
+			if t := &assignment.Tokens[idx]; !t.IsWhitespace() {
+				v, _ := typ.Convert(t.Value()) // Already checked during assignment
+				values = append(values, v)
+			}
+		}
+		if str, ok := values[0].(string); ok && assignment.Node.TypeFlags&MultiArgNode == 0 {
+			context.Put(name, str) // Like the value from a choice, which may differ in case
+		}
+		context.PutValue(name, typedValue(assignment.Node, values))
+	}
+}
+
+// Returns the value, or for multi arguments a slice of the right type, like []int64,
+// so the handler does not need to convert each value
+func typedValue(node *ArgNode, values []interface{}) interface{} {
+	if node.TypeFlags&MultiArgNode == 0 {
+		return values[0]
+	}
+	slice := reflect.MakeSlice(reflect.SliceOf(reflect.TypeOf(values[0])), 0, len(values))
+	for _, v := range values {
+		slice = reflect.Append(slice, reflect.ValueOf(v))
+	}
+	return slice.Interface()
+}
+
+// Sugests the type hints, and values used before
+func getTypedSugestorFn(name string) AcSugestorFn {
+	history := getArgumentSugestorFn(name)
+	return func(node *ArgNode, in TokenSet) (ret []string) {
+		ret = history(node, in)
+		if len(in) > 1 || node.ArgType.Hints == nil {
+			return
+		}
+		seen := make(map[string]bool)
+		for _, s := range ret {
+			seen[s] = true
+		}
+		for _, hint := range node.ArgType.Hints(in.Value()) {
+			if q := in.config().Quote(hint); !seen[q] {
+				seen[q] = true
+				ret = append(ret, q)
+			}
+		}
+		return
+	}
+}
+
+// Removes the noise from strconv errors, since we say what we tried to parse ourselves
+func numError(str string, err error) error {
+	if ne, ok := err.(*strconv.NumError); ok && ne.Err == strconv.ErrRange {
+		return fmt.Errorf("'%s' is out of range", str)
+	}
+	return fmt.Errorf("'%s' is not a number", str)
+}
+
+func convertInt(str string) (interface{}, error) {
+	// Not base 0, since a leading zero would make it octal
+	i, err := strconv.ParseInt(str, 10, 64)
+	lower, sign := strings.ToLower(str), ""
+	if strings.HasPrefix(lower, "-") || strings.HasPrefix(lower, "+") {
+		lower, sign = lower[1:], lower[:1]
+	}
+	// The sign goes before the prefix, like -0x1F, so ParseInt must not get another one after it
+	if digits := strings.TrimPrefix(lower, "0x"); digits != lower && !strings.HasPrefix(digits, "-") && !strings.HasPrefix(digits, "+") {
+		i, err = strconv.ParseInt(sign+digits, 16, 64)
+	}
+	if err != nil {
+		return nil, numError(str, err)
+	}
+	return i, nil
+}
+
+func convertFloat(str string) (interface{}, error) {
+	f, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return nil, numError(str, err)
+	}
+	return f, nil
+}
+
+var boolValues = map[string]bool{
+	"true": true, "yes": true, "on": true, "1": true,
+	"false": false, "no": false, "off": false, "0": false,
+}
+
+func convertBool(str string) (interface{}, error) {
+	if b, ok := boolValues[strings.ToLower(str)]; ok {
+		return b, nil
+	}
+	return nil, fmt.Errorf("'%s' is not true or false", str)
+}
+
+func boolHints(partial string) (ret []string) {
+	for _, h := range []string{"true", "false"} {
+		if strings.HasPrefix(h, strings.ToLower(partial)) {
+			ret = append(ret, h)
+		}
+	}
+	return
+}
+
+func convertDuration(str string) (interface{}, error) {
+	d, err := time.ParseDuration(str)
+	if err != nil {
+		return nil, fmt.Errorf("'%s' is not a duration, like 1h30m or 250ms", str)
+	}
+	return d, nil
+}
+
+var byteSizeUnits = map[string]float64{
+	"": 1, "b": 1,
+	"k": 1 << 10, "kib": 1 << 10, "kb": 1e3,
+	"m": 1 << 20, "mib": 1 << 20, "mb": 1e6,
+	"g": 1 << 30, "gib": 1 << 30, "gb": 1e9,
+	"t": 1 << 40, "tib": 1 << 40, "tb": 1e12,
+}
+
+func convertByteSize(str string) (interface{}, error) {
+	split := strings.IndexFunc(str, func(r rune) bool {
+		return r != '.' && !unicode.IsDigit(r)
+	})
+	if split < 0 {
+		split = len(str)
+	}
+	unit, ok := byteSizeUnits[strings.ToLower(strings.TrimSpace(str[split:]))]
+	if !ok {
+		return nil, fmt.Errorf("'%s' has an unknown unit. Use B, KB, MB, GB, TB or KiB, MiB, GiB, TiB", str)
+	}
+	num, err := strconv.ParseFloat(str[:split], 64)
+	if err != nil {
+		return nil, fmt.Errorf("'%s' is not a size, like 512, 10MB or 1.5GiB", str)
+	} else if size := num * unit; size >= 1<<63 { // The float of MaxInt64 is 1<<63, which does not fit
+		return nil, fmt.Errorf("'%s' is out of range", str)
+	} else {
+		return int64(size), nil
+	}
+}
+
+// Sugests the units after a number without one
+func unitHints(units ...string) func(partial string) []string {
+	return func(partial string) (ret []string) {
+		if _, err := strconv.ParseFloat(partial, 64); err == nil {
+			for _, u := range units {
+				ret = append(ret, partial+u)
+			}
+		}
+		return
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2016 Forau @ github.com. MIT License.
+
+package gocop
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestArgType_Convert(t *testing.T) {
+	check := func(typ *ArgType, input, expected string) {
+		v, err := typ.Convert(input)
+		res := fmt.Sprintf("%T(%v)", v, v)
+		if err != nil {
+			res = err.Error()
+		}
+		t.Logf("%s %q -> %s", typ.Name, input, res)
+		assertEqual(t, expected, res)
+	}
+
+	check(IntType, "6667", "int64(6667)")
+	check(IntType, "-12", "int64(-12)")
+	check(IntType, "0080", "int64(80)")
+	check(IntType, "0x1F", "int64(31)")
+	check(IntType, "-0x1F", "int64(-31)")
+	check(IntType, "-0x8000000000000000", "int64(-9223372036854775808)")
+	check(IntType, "0x-5", "'0x-5' is not a number")
+	check(IntType, "0x+5", "'0x+5' is not a number")
+	check(IntType, "12a", "'12a' is not a number")
+	check(IntType, "99999999999999999999", "'99999999999999999999' is out of range")
+	check(FloatType, "1.5e3", "float64(1500)")
+	check(FloatType, "one", "'one' is not a number")
+	check(BoolType, "Yes", "bool(true)")
+	check(BoolType, "off", "bool(false)")
+	check(BoolType, "maybe", "'maybe' is not true or false")
+	check(DurationType, "1h30m", "time.Duration(1h30m0s)")
+	check(DurationType, "5", "'5' is not a duration, like 1h30m or 250ms")
+	check(ByteSizeType, "512", "int64(512)")
+	check(ByteSizeType, "10MB", "int64(10000000)")
+	check(ByteSizeType, "1.5GiB", "int64(1610612736)")
+	check(ByteSizeType, "2k", "int64(2048)")
+	check(ByteSizeType, "5 PB", "'5 PB' has an unknown unit. Use B, KB, MB, GB, TB or KiB, MiB, GiB, TiB")
+	check(ByteSizeType, "MB", "'MB' is not a size, like 512, 10MB or 1.5GiB")
+	check(ByteSizeType, "99999999TiB", "'99999999TiB' is out of range")
+	check(ByteSizeType, "8388608TiB", "'8388608TiB' is out of range")
+	check(ByteSizeType, "8388607TiB", "int64(9223370937343148032)")
+}
+
+func TestArgNode_TypedArguments(t *testing.T) {
+	n := NewWorldNode()
+	n.AddSubCommand("/connect").Handler(func(rc RunContext) (interface{}, error) {
+		return fmt.Sprintf("%s %q %#v", rc.Get("server"), rc.Get("port"), rc.GetValue("port")), nil
+	}).AddArgument("server").AddIntArgument("port").Optional()
+	n.AddSubCommand("/away").AddBoolArgument("away").AddDurationArgument("for").
+		Handler(func(rc RunContext) (interface{}, error) {
+			return fmt.Sprint(rc.GetValue("away"), " ", rc.GetValue("for").(time.Duration)), nil
+		})
+	n.AddSubCommand("/sum").AddFloatArgument("numbers").Times(1, 10).
+		Handler(func(rc RunContext) (interface{}, error) {
+			sum := 0.0
+			for _, f := range rc.GetValue("numbers").([]float64) {
+				sum += f
+			}
+			return sum, nil
+		})
+
+	check := func(input, expected string) {
+		res, err := n.InvokeCommand(input, &DefaultRunContext{values: make(map[string]string)})
+		if err != nil {
+			res = strings.Split(err.Error(), "\n")[0]
+			if ia, ok := err.(*InvalidArgument); ok {
+				res = ia.Marker() + fmt.Sprint(res)
+			}
+		}
+		t.Logf("%q -> %v", input, res)
+		assertEqual(t, expected, fmt.Sprint(res))
+	}
+
+	check("/connect irc.example.com 6667", `irc.example.com "6667" 6667`)
+	check("/connect irc.example.com", `irc.example.com "" <nil>`)
+	check("/connect irc.example.com six", "/connect irc.example.com six\n                         ^~~\nInvalid int for port: 'six' is not a number")
+	check("/away yes 1h", "true 1h0m0s")
+	check("/away sure 1h", "/away sure 1h\n      ^~~~\nInvalid bool for away: 'sure' is not true or false")
+	check("/sum 1 2.5 -1", "2.5")
+	check("/sum 1 x 3", "/sum 1 x 3\n       ^\nInvalid float for numbers: 'x' is not a number")
+
+	usage := strings.Join(n.Usage("", ""), "\n")
+	t.Log(usage)
+	assertEqual(t, "true", fmt.Sprint(strings.Contains(usage, "/connect [server] [port:int?]")))
+	assertEqual(t, "true", fmt.Sprint(strings.Contains(usage, "/sum [numbers:float*]")))
+}
+
+func TestArgNode_TypedArgumentHints(t *testing.T) {
+	n := NewWorldNode()
+	n.AddSubCommand("/away").AddBoolArgument("away.hint").AddDurationArgument("for.hint")
+	n.AddSubCommand("/upload").AddByteSizeArgument("limit.hint")
+
+	check := func(input string, expected ...string) {
+		sug := n.SugestAutoComplete(Tokenize(input))
+		t.Logf("Sugestions for %q: %q", input, sug)
+		assertEqual(t, strings.Join(expected, "|"), strings.Join(sug, "|"))
+	}
+
+	check("/away ", "/away true", "/away false")
+	check("/away f", "/away false")
+	check("/away yes 15", "/away yes 15ms", "/away yes 15s", "/away yes 15m", "/away yes 15h")
+	check("/away yes 15x")
+	check("/upload 1.5", "/upload 1.5B", "/upload 1.5KiB", "/upload 1.5MiB", "/upload 1.5GiB")
+}
@@ -0,0 +1,156 @@
+// Copyright (c) 2016 Forau @ github.com. MIT License.
+
+package gocop
+
+import (
+	"os"
+	"sort"
+	"strings"
+
+	"bytes"
+)
+
+// Looks up a variable by name, and reports if it was found
+type VarLookupFn func(name string) (string, bool)
+
+// Session variables, used for $VAR and ${VAR} expansion.
+// Variables that are not set in the session are looked up in the process environment.
+type Variables struct {
+	values map[string]string
+}
+
+func NewVariables() *Variables {
+	return &Variables{values: make(map[string]string)}
+}
+
+func (v *Variables) Set(name, value string) {
+	v.values[name] = value
+}
+
+func (v *Variables) Unset(name string) {
+	delete(v.values, name)
+}
+
+// Looks in the session first, and then in the environment
+func (v *Variables) Lookup(name string) (string, bool) {
+	if val, ok := v.values[name]; ok {
+		return val, true
+	}
+	return os.LookupEnv(name)
+}
+
+// Returns the sorted names of the session variables
+func (v *Variables) Names() (names []string) {
+	for n := range v.values {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return
+}
+
+// Returns the sorted names of both session and environment variables
+func (v *Variables) allNames() []string {
+	names := v.Names()
+	for _, env := range os.Environ() {
+		if idx := strings.IndexByte(env, '='); idx > 0 {
+			if _, ok := v.values[env[:idx]]; !ok {
+				names = append(names, env[:idx])
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func isVarNameRune(r rune, first bool) bool {
+	return r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (!first && r >= '0' && r <= '9')
+}
+
+// Parses the name after a $, which is either a plain name, or a name in braces.
+// Returns the name, and how many bytes it used. 0 if there was no name.
+func parseVarName(str string) (name string, n int) {
+	braced := strings.HasPrefix(str, "{")
+	if braced {
+		n = 1
+	}
+	for n < len(str) && isVarNameRune(rune(str[n]), n == 0 || (braced && n == 1)) {
+		n++
+	}
+	if braced {
+		if n == 1 || n >= len(str) || str[n] != '}' {
+			return "", 0
+		}
+		return str[1:n], n + 1
+	}
+	return str[:n], n
+}
+
+// Completes a variable name, if the line ends with $ or ${ followed by a partial name.
+func (cp *CommandParser) completeVariable(tokens TokenSet) (ret []string) {
+	if len(tokens) == 0 {
+		return
+	}
+	last := tokens[len(tokens)-1]
+	if last.Type != TokenString && last.Type != TokenDQuoted {
+		return
+	}
+	dollar := strings.LastIndexByte(last.val, '$')
+	if dollar < 0 || (dollar > 0 && last.config().endsWithEscape(last.val[:dollar])) {
+		return
+	}
+	partial := last.val[dollar+1:]
+	braced := strings.HasPrefix(partial, "{")
+	if braced {
+		partial = partial[1:]
+	}
+	for _, r := range partial {
+		if !isVarNameRune(r, false) {
+			return
+		}
+	}
+
+	prefix := tokens.String()
+	prefix = prefix[:len(prefix)-len(partial)]
+	for _, name := range cp.Vars.allNames() {
+		if strings.HasPrefix(name, partial) {
+			if braced {
+				ret = append(ret, prefix+name+"}")
+			} else {
+				ret = append(ret, prefix+name)
+			}
+		}
+	}
+	return
+}
+
+// Sugests names of session variables
+func (cp *CommandParser) variableSugestorFn(node *ArgNode, in TokenSet) (ret []string) {
+	if len(in) <= 1 {
+		val := in.String()
+		for _, name := range cp.Vars.Names() {
+			if strings.HasPrefix(name, val) {
+				ret = append(ret, name)
+			}
+		}
+	}
+	return
+}
+
+func (cp *CommandParser) setVariable(rc RunContext) (interface{}, error) {
+	cp.Vars.Set(rc.Get("variable"), rc.Get("value"))
+	return nil, nil
+}
+
+func (cp *CommandParser) unsetVariable(rc RunContext) (interface{}, error) {
+	cp.Vars.Unset(rc.Get("variable"))
+	return nil, nil
+}
+
+func (cp *CommandParser) listVariables(rc RunContext) (interface{}, error) {
+	var buf bytes.Buffer
+	for _, name := range cp.Vars.Names() {
+		val, _ := cp.Vars.Lookup(name)
+		buf.WriteString(name + "=" + val + "\n")
+	}
+	return buf.String(), nil
+}
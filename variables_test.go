@@ -0,0 +1,76 @@
+// Copyright (c) 2016 Forau @ github.com. MIT License.
+
+package gocop
+
+import (
+	"os"
+	"testing"
+)
+
+func TestParseVarName(t *testing.T) {
+	check := func(in, expName string, expN int) {
+		name, n := parseVarName(in)
+		if name != expName || n != expN {
+			t.Errorf("Parsing '%s', expected '%s' and %d but got '%s' and %d", in, expName, expN, name, n)
+		}
+	}
+	check("SERVER rest", "SERVER", 6)
+	check("{SERVER}rest", "SERVER", 8)
+	check("_a1-b", "_a1", 3)
+	check("1abc", "", 0)
+	check("{open", "", 0)
+	check("{}", "", 0)
+	check("", "", 0)
+}
+
+func TestTokenSet_ExpandVariables(t *testing.T) {
+	vars := NewVariables()
+	vars.Set("server", "irc.example.com")
+	vars.Set("chan", "#go")
+	os.Setenv("GOCOP_TEST_ENV", "from env")
+	defer os.Unsetenv("GOCOP_TEST_ENV")
+
+	check := func(input, expected string) {
+		tokens := Tokenize(input)
+		expanded := tokens.ExpandVariables(vars.Lookup)
+		assertEqual(t, expected, expanded.Value())
+		assertEqual(t, input, expanded.String())
+		assertEqual(t, tokens.Value(), Tokenize(input).Value()) // The input is not modified
+	}
+
+	check("/connect $server", "/connect irc.example.com")
+	check("/join ${chan}-dev", "/join #go-dev")
+	check(`/msg "$chan" "hi from $GOCOP_TEST_ENV"`, "/msg #go hi from from env")
+	check(`/msg '$chan' \$chan`, "/msg $chan $chan")
+	check(`/msg $undefined\ x $ $1`, "/msg  x $ $1")
+	check(`/msg a\ $chan\ b`, "/msg a #go b")
+
+	vars.Set("quoted", `"\n`)
+	check(`/msg $quoted`, `/msg "\n`)
+}
+
+func TestCommandParser_SetAndUnsetVariables(t *testing.T) {
+	cp := NewCommandParser()
+	var got string
+	cp.NewWorld().AddSubCommand("echo").AddArgument("text").Times(1, 99).Handler(func(rc RunContext) (interface{}, error) {
+		got = rc.Get("text")
+		return got, nil
+	})
+
+	if _, err := cp.Execute("set greeting hello there"); err != nil {
+		t.Fatal(err)
+	}
+	cp.Execute("echo $greeting 'and $greeting'")
+	assertEqual(t, "hello there and $greeting", got)
+
+	res, _ := cp.Execute("vars")
+	assertEqual(t, "greeting=hello there\n", res.(string))
+
+	assertEqual(t, "echo $greeting", cp.AutoCompleter("echo $gr")[0])
+	assertEqual(t, "echo ${greeting}", cp.AutoCompleter("echo ${gre")[0])
+	assertEqual(t, "unset greeting", cp.AutoCompleter("unset g")[0])
+
+	cp.Execute("unset greeting")
+	cp.Execute("echo [$greeting]")
+	assertEqual(t, "[]", got)
+}